@@ -0,0 +1,180 @@
+// Package check defines behavioural checks of MiGo programs by exploring
+// the state space of the operational semantics (see package semantics).
+//
+// The state space is explored from the entry function up to a bound on the
+// number of configurations, with configurations identified by their
+// semantics.Config.Key. If a new configuration is over the bound, the
+// configuration reaching it is not expanded and the exploration is
+// incomplete, and the checks may miss errors in the unexplored part.
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+// DefaultMaxStates is the default bound on the number of configurations.
+const DefaultMaxStates = 100000
+
+// Options is the options of the exploration.
+type Options struct {
+	Entry     string // Entry function, default "main".
+	MaxStates int    // Bound on the number of configurations, default DefaultMaxStates.
+	DFS       bool   // Explore depth-first instead of breadth-first.
+}
+
+func (o Options) entry() string {
+	if o.Entry == "" {
+		return "main"
+	}
+	return o.Entry
+}
+
+func (o Options) maxStates() int {
+	if o.MaxStates <= 0 {
+		return DefaultMaxStates
+	}
+	return o.MaxStates
+}
+
+// State is a configuration in the state graph.
+type State struct {
+	ID     int
+	Config *semantics.Config
+	Edges  []Edge // Transitions from the state (nil if not expanded).
+
+	parent *State // predecessor on the first path found
+	label  int    // index of the edge from parent
+}
+
+// Edge is a transition between states in the state graph.
+type Edge struct {
+	Label semantics.Label
+	To    *State
+}
+
+// Graph is the state graph of a program.
+type Graph struct {
+	Initial  *State
+	States   []*State // States by ID.
+	Complete bool     // Whether all reachable states are expanded.
+}
+
+// Explore returns the state graph of Program prog.
+//
+// With breadth-first exploration (the default) the path from the initial
+// state to each state given by Trace is a shortest path.
+func Explore(prog *migo.Program, opts Options) (*Graph, error) {
+	cfg, err := semantics.NewConfig(prog, opts.entry())
+	if err != nil {
+		return nil, err
+	}
+	g := &Graph{Complete: true}
+	visited := make(map[string]*State)
+	// add returns the state of c, with whether it is new, or nil if c is a
+	// new configuration over the bound on the number of states.
+	add := func(c *semantics.Config) (*State, bool) {
+		k := c.Key()
+		if s, ok := visited[k]; ok {
+			return s, false
+		}
+		if len(g.States) >= opts.maxStates() {
+			return nil, false
+		}
+		s := &State{ID: len(g.States), Config: c, label: -1}
+		visited[k] = s
+		g.States = append(g.States, s)
+		return s, true
+	}
+	g.Initial, _ = add(cfg)
+	pending := []*State{g.Initial}
+	for len(pending) > 0 {
+		var s *State
+		if opts.DFS {
+			s, pending = pending[len(pending)-1], pending[:len(pending)-1]
+		} else {
+			s, pending = pending[0], pending[1:]
+		}
+		ts := semantics.Successors(s.Config)
+		edges := make([]Edge, len(ts))
+		var added []*State
+		for i, t := range ts {
+			next, isNew := add(t.Next)
+			if next == nil { // s is left unexpanded
+				g.Complete = false
+				for _, a := range added {
+					delete(visited, a.Config.Key())
+				}
+				g.States = g.States[:len(g.States)-len(added)]
+				edges = nil
+				break
+			}
+			edges[i] = Edge{Label: t.Label, To: next}
+			if isNew {
+				next.parent, next.label = s, i
+				added = append(added, next)
+			}
+		}
+		if edges == nil {
+			continue
+		}
+		s.Edges = edges
+		pending = append(pending, added...)
+	}
+	return g, nil
+}
+
+// Expanded returns true if the transitions of state s are computed.
+func (s *State) Expanded() bool {
+	return s.Edges != nil
+}
+
+// Trace returns the transitions from the initial state to state s.
+func (g *Graph) Trace(s *State) Trace {
+	var tr Trace
+	for ; s.parent != nil; s = s.parent {
+		tr = append(tr, s.parent.Edges[s.label].Label)
+	}
+	for i, j := 0, len(tr)-1; i < j; i, j = i+1, j-1 {
+		tr[i], tr[j] = tr[j], tr[i]
+	}
+	return tr
+}
+
+// Trace is a sequence of transitions.
+type Trace []semantics.Label
+
+func (tr Trace) String() string {
+	var sb strings.Builder
+	for i, l := range tr {
+		sb.WriteString(fmt.Sprintf("  %d. %s\n", i+1, l.String()))
+	}
+	return sb.String()
+}
+
+// Blocked is a process blocked in a configuration.
+type Blocked struct {
+	PID  int
+	Func *migo.Function
+	Stmt migo.Statement
+}
+
+func (b Blocked) String() string {
+	stmt := b.Stmt.String()
+	if i := strings.IndexByte(stmt, '\n'); i >= 0 {
+		stmt = stmt[:i]
+	}
+	return fmt.Sprintf("%d@%s: %s", b.PID, b.Func.Name, stmt)
+}
+
+// blocked returns the processes of configuration c.
+func blocked(c *semantics.Config) []Blocked {
+	bs := make([]Blocked, len(c.Procs))
+	for i, p := range c.Procs {
+		bs[i] = Blocked{PID: p.PID, Func: p.Func(), Stmt: p.Stmt()}
+	}
+	return bs
+}
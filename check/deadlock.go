@@ -0,0 +1,54 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// Deadlock is a reachable configuration where all processes are blocked,
+// i.e. it has no transitions but has not terminated nor panicked.
+type Deadlock struct {
+	Blocked []Blocked // Blocked processes.
+	Trace   Trace     // Transitions from the initial configuration.
+}
+
+func (d *Deadlock) String() string {
+	procs := make([]string, len(d.Blocked))
+	for i, b := range d.Blocked {
+		procs[i] = b.String()
+	}
+	return fmt.Sprintf("deadlock: %s\n%s", strings.Join(procs, ", "), d.Trace)
+}
+
+// DeadlockResult is the result of Deadlocks.
+type DeadlockResult struct {
+	Deadlocks []*Deadlock
+	States    int  // Number of configurations explored.
+	Complete  bool // Whether all reachable configurations are explored.
+}
+
+// Deadlocks returns the global deadlocks of Program prog.
+// With breadth-first exploration, the trace of each deadlock is minimal.
+func Deadlocks(prog *migo.Program, opts Options) (*DeadlockResult, error) {
+	g, err := Explore(prog, opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.Deadlocks(), nil
+}
+
+// Deadlocks returns the global deadlocks in the state graph.
+func (g *Graph) Deadlocks() *DeadlockResult {
+	res := &DeadlockResult{States: len(g.States), Complete: g.Complete}
+	for _, s := range g.States {
+		if !s.Expanded() || len(s.Edges) > 0 {
+			continue
+		}
+		if c := s.Config; !c.Terminated() && c.Panic == "" {
+			res.Deadlocks = append(res.Deadlocks, &Deadlock{Blocked: blocked(c), Trace: g.Trace(s)})
+		}
+	}
+	return res
+}
@@ -0,0 +1,161 @@
+package check_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/check"
+	"github.com/nickng/migo/v3/parser"
+)
+
+func parse(t *testing.T, s string) *migo.Program {
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return prog
+}
+
+func TestDeadlocks(t *testing.T) {
+	tests := []struct {
+		name      string
+		prog      string
+		deadlocks []string
+	}{
+		{
+			name: "sync",
+			prog: `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch;
+def s(c): send c;`,
+		},
+		{
+			name: "missing sender",
+			prog: `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch; recv ch;
+def s(c): send c;`,
+			deadlocks: []string{"0@main: recv ch"},
+		},
+		{
+			name: "lock order",
+			prog: `def main(): letsync a mutex; letsync b mutex; spawn f(a, b); lock b; lock a; unlock a; unlock b;
+def f(x, y): lock x; lock y; unlock y; unlock x;`,
+			deadlocks: []string{"0@main: lock a, 1@f: lock y"},
+		},
+		{
+			name: "mutex and rwmutex through shared callee",
+			prog: `def main(): letsync m mutex; letsync r rwmutex; call f(r); lock m; call f(m);
+def f(x): lock x; unlock x;`,
+			deadlocks: []string{"0@f: lock x"},
+		},
+		{
+			name:      "buffered",
+			prog:      `def main(): let ch = newchan ch, 1; send ch; recv ch; send ch; send ch;`,
+			deadlocks: []string{"0@main: send ch"},
+		},
+		{
+			name: "select",
+			prog: `def main(): let a = newchan a, 0; let b = newchan b, 0;
+  select case recv a; case send b; endselect;`,
+			deadlocks: []string{"0@main: select"},
+		},
+		{
+			name: "panic is not deadlock",
+			prog: `def main(): let a = newchan a, 0; close a; close a;`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.Deadlocks(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.Complete {
+				t.Error("expected complete exploration")
+			}
+			var got []string
+			for _, d := range res.Deadlocks {
+				procs := make([]string, len(d.Blocked))
+				for i, b := range d.Blocked {
+					procs[i] = b.String()
+				}
+				got = append(got, strings.Join(procs, ", "))
+			}
+			if want, got := strings.Join(test.deadlocks, "\n"), strings.Join(got, "\n"); want != got {
+				t.Errorf("expected deadlocks\n%s\nbut got\n%s", want, got)
+			}
+		})
+	}
+}
+
+// Traces of deadlocks are minimal with breadth-first exploration.
+func TestDeadlockTrace(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 0; spawn s(ch); call loop(ch);
+def loop(c): if tau; tau; call loop(c); else recv c; recv c; endif;
+def s(c): send c;`)
+	res, err := check.Deadlocks(prog, check.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(res.Deadlocks); want != got {
+		t.Fatalf("expected %d deadlock but got %d", want, got)
+	}
+	want := `deadlock: 0@loop: recv c
+  1. newchan [0@main: let ch = newchan ch, 0]
+  2. spawn [0@main: spawn s(ch)]
+  3. call [0@main: call loop(ch)]
+  4. branch [0@loop: if tau; tau; call loop(c); else recv c; recv c; endif else]
+  5. sync [1@s: send c | 0@loop: recv c]
+`
+	if got := res.Deadlocks[0].String(); want != got {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestDeadlockBound(t *testing.T) {
+	// Unbounded number of processes.
+	prog := parse(t, `def main(): let ch = newchan ch, 0; call loop(ch);
+def loop(c): spawn s(c); call loop(c);
+def s(c): send c;`)
+	res, err := check.Deadlocks(prog, check.Options{MaxStates: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Complete {
+		t.Error("expected incomplete exploration")
+	}
+	if want, got := 50, res.States; got > want {
+		t.Errorf("expected at most %d states but got %d", want, got)
+	}
+	if _, err := check.Deadlocks(prog, check.Options{Entry: "nomain"}); err == nil {
+		t.Error("expected error for missing entry")
+	}
+}
+
+// The exploration is complete if the bound is reached without dropping a
+// new state.
+func TestDeadlockBoundReached(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 0; recv ch;`)
+	tests := []struct {
+		maxStates int
+		complete  bool
+		deadlocks int
+	}{
+		{maxStates: 1, complete: false, deadlocks: 0},
+		{maxStates: 2, complete: true, deadlocks: 1},
+	}
+	for _, test := range tests {
+		res, err := check.Deadlocks(prog, check.Options{MaxStates: test.maxStates})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := test.complete, res.Complete; want != got {
+			t.Errorf("MaxStates %d: expected complete %t but got %t", test.maxStates, want, got)
+		}
+		if want, got := test.maxStates, res.States; want != got {
+			t.Errorf("MaxStates %d: expected %d states but got %d", test.maxStates, want, got)
+		}
+		if want, got := test.deadlocks, len(res.Deadlocks); want != got {
+			t.Errorf("MaxStates %d: expected %d deadlocks but got %d", test.maxStates, want, got)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nickng/migo/v3"
+)
+
+// LivenessViolation is a channel operation (send, recv or select) which can
+// be blocked forever, i.e. there is a fair path from a reachable state where
+// the process waiting on the operation never fires it.
+//
+// The counterexample is a lasso: Stem leads from the initial configuration
+// to a configuration where the process is blocked on the operation, from
+// which Loop can be repeated forever without the process firing it. Loop is
+// empty if the configuration is a global deadlock.
+type LivenessViolation struct {
+	PID  int
+	Func *migo.Function
+	Stmt migo.Statement
+	Stem Trace
+	Loop Trace
+}
+
+func (v *LivenessViolation) String() string {
+	s := fmt.Sprintf("%s can be blocked forever\n%s", Blocked{PID: v.PID, Func: v.Func, Stmt: v.Stmt}, v.Stem)
+	if len(v.Loop) > 0 {
+		s += fmt.Sprintf("  loop:\n%s", v.Loop)
+	}
+	return s
+}
+
+// LivenessResult is the result of Liveness.
+type LivenessResult struct {
+	Violations []*LivenessViolation // At most one per statement.
+	States     int                  // Number of configurations explored.
+	Complete   bool                 // Whether all reachable configurations are explored.
+}
+
+// Liveness returns the channel operations of Program prog
+// which can be blocked forever.
+func Liveness(prog *migo.Program, opts Options) (*LivenessResult, error) {
+	g, err := Explore(prog, opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.Liveness(), nil
+}
+
+// Liveness returns the channel operations which can be blocked forever in
+// the state graph.
+//
+// For each process p, the states where p waits on a channel operation form
+// a subgraph with the transitions not involving p (which do not change the
+// continuation of p). A strongly connected component of the subgraph is bad
+// if it is a global deadlock, or if it has a cycle through a state where p
+// is disabled and it is fair, i.e. there is a fair path through its states
+// where p never fires. The fairness assumption is weak fairness: a process
+// which is enabled in every state of a path eventually fires, so a component
+// is fair if every process enabled in all its states has a transition in it.
+//
+// Unexpanded states (if the exploration is incomplete) are ignored.
+func (g *Graph) Liveness() *LivenessResult {
+	res := &LivenessResult{States: len(g.States), Complete: g.Complete}
+	pids := make(map[int]bool)
+	for _, s := range g.States {
+		for _, p := range s.Config.Procs {
+			pids[p.PID] = true
+		}
+	}
+	type candidate struct {
+		pid   int
+		entry *State
+		scc   map[*State]bool
+	}
+	var candidates []candidate
+	for pid := range pids {
+		for _, scc := range g.waitSCCs(pid) {
+			if entry := g.badSCC(pid, scc); entry != nil {
+				candidates = append(candidates, candidate{pid: pid, entry: entry, scc: scc})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].entry.ID != candidates[j].entry.ID {
+			return candidates[i].entry.ID < candidates[j].entry.ID
+		}
+		return candidates[i].pid < candidates[j].pid
+	})
+	reported := make(map[migo.Statement]bool)
+	for _, c := range candidates {
+		p, _ := c.entry.Config.Proc(c.pid)
+		if reported[p.Stmt()] {
+			continue
+		}
+		reported[p.Stmt()] = true
+		res.Violations = append(res.Violations, &LivenessViolation{
+			PID:  c.pid,
+			Func: p.Func(),
+			Stmt: p.Stmt(),
+			Stem: g.Trace(c.entry),
+			Loop: g.loop(c.pid, c.entry, c.scc),
+		})
+	}
+	return res
+}
+
+// waiting returns true if process pid waits on a channel operation in s.
+func waiting(s *State, pid int) bool {
+	if !s.Expanded() {
+		return false
+	}
+	p, ok := s.Config.Proc(pid)
+	if !ok {
+		return false
+	}
+	switch p.Stmt().(type) {
+	case *migo.SendStatement, *migo.RecvStatement, *migo.SelectStatement:
+		return true
+	}
+	return false
+}
+
+// involves returns true if process pid acts in edge e.
+func involves(e Edge, pid int) bool {
+	for _, p := range e.Label.Pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// disabled returns true if process pid has no transition in s.
+func disabled(s *State, pid int) bool {
+	for _, e := range s.Edges {
+		if involves(e, pid) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitSCCs returns the strongly connected components of the states where
+// process pid waits on a channel operation, with the transitions not
+// involving pid.
+func (g *Graph) waitSCCs(pid int) []map[*State]bool {
+	index := make(map[*State]int)
+	low := make(map[*State]int)
+	onStack := make(map[*State]bool)
+	var stack []*State
+	var sccs []map[*State]bool
+	var visit func(s *State)
+	visit = func(s *State) {
+		index[s] = len(index)
+		low[s] = index[s]
+		stack = append(stack, s)
+		onStack[s] = true
+		for _, e := range s.Edges {
+			if involves(e, pid) || !waiting(e.To, pid) {
+				continue
+			}
+			if _, visited := index[e.To]; !visited {
+				visit(e.To)
+				if low[e.To] < low[s] {
+					low[s] = low[e.To]
+				}
+			} else if onStack[e.To] && index[e.To] < low[s] {
+				low[s] = index[e.To]
+			}
+		}
+		if low[s] == index[s] {
+			scc := make(map[*State]bool)
+			for {
+				t := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[t] = false
+				scc[t] = true
+				if t == s {
+					break
+				}
+			}
+			sccs = append(sccs, scc)
+		}
+	}
+	for _, s := range g.States {
+		if _, visited := index[s]; !visited && waiting(s, pid) {
+			visit(s)
+		}
+	}
+	return sccs
+}
+
+// badSCC returns the state with the lowest ID of scc if scc is bad for
+// process pid, or nil otherwise.
+func (g *Graph) badSCC(pid int, scc map[*State]bool) *State {
+	var entry *State
+	bad := false
+	for s := range scc {
+		if entry == nil || s.ID < entry.ID {
+			entry = s
+		}
+		if len(s.Edges) == 0 && s.Config.Panic == "" {
+			bad = true // global deadlock
+		}
+		if disabled(s, pid) && g.onCycle(pid, s, scc) && fair(pid, scc) {
+			bad = true
+		}
+	}
+	if !bad {
+		return nil
+	}
+	return entry
+}
+
+// fair returns true if every process (other than pid) enabled in all states
+// of scc has a transition in scc not involving pid.
+func fair(pid int, scc map[*State]bool) bool {
+	pids := make(map[int]bool)
+	for s := range scc {
+		for _, p := range s.Config.Procs {
+			if p.PID != pid {
+				pids[p.PID] = true
+			}
+		}
+	}
+	for q := range pids {
+		enabled, fires := true, false
+		for s := range scc {
+			if disabled(s, q) {
+				enabled = false
+				break
+			}
+			for _, e := range s.Edges {
+				if scc[e.To] && involves(e, q) && !involves(e, pid) {
+					fires = true
+				}
+			}
+		}
+		if enabled && !fires {
+			return false
+		}
+	}
+	return true
+}
+
+// onCycle returns true if state s is on a cycle in scc without pid.
+func (g *Graph) onCycle(pid int, s *State, scc map[*State]bool) bool {
+	if len(scc) > 1 {
+		return true
+	}
+	for _, e := range s.Edges {
+		if e.To == s && !involves(e, pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// loop returns a cycle from entry through a state where process pid is
+// disabled in scc, or nil if entry is a global deadlock.
+func (g *Graph) loop(pid int, entry *State, scc map[*State]bool) Trace {
+	if len(entry.Edges) == 0 {
+		return nil
+	}
+	var toDisabled []Edge
+	mid := entry
+	if !disabled(entry, pid) {
+		toDisabled = g.path(pid, entry, scc, func(s *State) bool { return disabled(s, pid) })
+		mid = toDisabled[len(toDisabled)-1].To
+	}
+	back := g.path(pid, mid, scc, func(s *State) bool { return s == entry })
+	var tr Trace
+	for _, e := range append(toDisabled, back...) {
+		tr = append(tr, e.Label)
+	}
+	return tr
+}
+
+// path returns a shortest non-empty path from state from in scc to a state
+// satisfying target, with transitions not involving pid.
+func (g *Graph) path(pid int, from *State, scc map[*State]bool, target func(*State) bool) []Edge {
+	type step struct {
+		prev *step
+		edge Edge
+	}
+	visited := make(map[*State]bool)
+	queue := []*step{}
+	for _, e := range from.Edges {
+		if !involves(e, pid) && scc[e.To] {
+			queue = append(queue, &step{edge: e})
+		}
+	}
+	for len(queue) > 0 {
+		st := queue[0]
+		queue = queue[1:]
+		if visited[st.edge.To] {
+			continue
+		}
+		visited[st.edge.To] = true
+		if target(st.edge.To) {
+			var edges []Edge
+			for ; st != nil; st = st.prev {
+				edges = append([]Edge{st.edge}, edges...)
+			}
+			return edges
+		}
+		for _, e := range st.edge.To.Edges {
+			if !involves(e, pid) && scc[e.To] && !visited[e.To] {
+				queue = append(queue, &step{prev: st, edge: e})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package check_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/check"
+)
+
+func TestLiveness(t *testing.T) {
+	tests := []struct {
+		name       string
+		prog       string
+		violations []string
+	}{
+		{
+			name: "producer consumer",
+			prog: `def main(): let ch = newchan ch, 0; spawn p(ch); call c(ch);
+def p(x): send x; call p(x);
+def c(x): recv x; call c(x);`,
+		},
+		{
+			name: "partial deadlock",
+			prog: `def main(): let ch = newchan ch, 0; spawn r(ch); call loop();
+def loop(): tau; call loop();
+def r(x): recv x;`,
+			violations: []string{"1@r: recv x"},
+		},
+		{
+			name:       "global deadlock",
+			prog:       `def main(): let ch = newchan ch, 0; recv ch;`,
+			violations: []string{"0@main: recv ch"},
+		},
+		{
+			name: "select starves sender",
+			prog: `def main(): let a = newchan a, 0; spawn s(a); call loop(a);
+def loop(x): select case recv x; case tau; endselect; call loop(x);
+def s(x): send x;`,
+			violations: []string{"1@s: send x"},
+		},
+		{
+			name: "buffered",
+			prog: `def main(): let ch = newchan ch, 2; spawn p(ch); call c(ch);
+def p(x): send x; call p(x);
+def c(x): recv x; call c(x);`,
+		},
+		{
+			// The loop alone is unfair to snd, which eventually sends.
+			name: "unfair loop",
+			prog: `def main(): let c = newchan c, 0; spawn loop(); spawn snd(c); recv c;
+def loop(): tau; call loop();
+def snd(c): tau; send c;`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.Liveness(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range res.Violations {
+				got = append(got, check.Blocked{PID: v.PID, Func: v.Func, Stmt: v.Stmt}.String())
+			}
+			if want, got := strings.Join(test.violations, "\n"), strings.Join(got, "\n"); want != got {
+				t.Errorf("expected violations\n%s\nbut got\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestLivenessLasso(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 0; spawn r(ch); call loop();
+def loop(): tau; call loop();
+def r(x): recv x;`)
+	res, err := check.Liveness(prog, check.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(res.Violations); want != got {
+		t.Fatalf("expected %d violation but got %d", want, got)
+	}
+	want := `1@r: recv x can be blocked forever
+  1. newchan [0@main: let ch = newchan ch, 0]
+  2. spawn [0@main: spawn r(ch)]
+  3. call [0@main: call loop()]
+  loop:
+  1. tau [0@loop: tau]
+  2. call [0@loop: call loop()]
+`
+	if got := res.Violations[0].String(); want != got {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
@@ -0,0 +1,601 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+// MutexKind is the kind of a mutex misuse.
+type MutexKind int
+
+const (
+	DoubleLock     MutexKind = iota // Lock of a mutex held by the same process (self-deadlock).
+	UnlockUnlocked                  // Unlock of a mutex not held by the process.
+	HeldAtExit                      // Mutex held when the process terminates.
+	LockOrder                       // Mutexes locked in different orders by processes.
+
+	RLockRecursion      // Read lock of a rwmutex read-held by the process, which a writer may lock.
+	RUnlockWithoutRLock // Read unlock of a rwmutex not read-held by the process.
+	LockUpgrade         // Write lock of a rwmutex read-held by the process (self-deadlock).
+)
+
+func (k MutexKind) String() string {
+	switch k {
+	case DoubleLock:
+		return "double lock"
+	case UnlockUnlocked:
+		return "unlock of unlocked mutex"
+	case HeldAtExit:
+		return "mutex held at exit"
+	case LockOrder:
+		return "lock order inversion"
+	case RLockRecursion:
+		return "recursive read lock"
+	case RUnlockWithoutRLock:
+		return "runlock without rlock"
+	case LockUpgrade:
+		return "lock upgrade"
+	}
+	return fmt.Sprintf("MutexKind(%d)", int(k))
+}
+
+// MutexViolation is a misuse of mutexes.
+type MutexViolation struct {
+	Kind    MutexKind
+	Mutexes []string // Names of the mutexes (two for LockOrder) when created.
+
+	// Ops are the statements of the violation: the lock for DoubleLock, the
+	// unlock for UnlockUnlocked, the lock of the mutex held for HeldAtExit,
+	// and for LockOrder the locks of the second mutex while holding the
+	// first, and of the first mutex while holding the second. For rwmutexes,
+	// the rlock and the first rlock for RLockRecursion, the runlock for
+	// RUnlockWithoutRLock, and the lock and the rlock for LockUpgrade.
+	Ops []Op
+}
+
+func (v *MutexViolation) String() string {
+	ops := make([]string, len(v.Ops))
+	for i, op := range v.Ops {
+		ops[i] = fmt.Sprintf("%s (%s)", op.Stmt, op.Pos())
+	}
+	return fmt.Sprintf("%s %s: %s", v.Kind, strings.Join(v.Mutexes, ", "), strings.Join(ops, ", "))
+}
+
+// MutexResult is the result of Mutexes.
+type MutexResult struct {
+	Violations []*MutexViolation
+}
+
+// Mutexes returns the misuses of mutexes in Program prog, by a lock-set
+// dataflow analysis of the processes of the program.
+//
+// The mutexes are approximated as in StaticSafety, i.e. a mutex is
+// identified by its letsync statement (or name if global), but parameters
+// are bound to the mutexes of the arguments at each call and spawn, and a
+// process is identified by its root function and the binding of its
+// parameters. The analysis computes for each statement the mutexes which
+// may be held, and must be held, by the process running it, through calls
+// (with a summary of each function for each binding of its parameters and
+// lock-set on entry), and reports:
+//
+//	DoubleLock           a lock of a mutex which may be held
+//	UnlockUnlocked       an unlock of a mutex which may not be held
+//	HeldAtExit           a mutex which may be held at the end of a process
+//	LockOrder            a pair of mutexes locked in both orders, by
+//	                     different processes or a process which may run
+//	                     more than once
+//
+// The write locks of rwmutexes are analysed as mutexes, and the read locks
+// are tracked separately (with the number of read locks which must be held)
+// to report:
+//
+//	RLockRecursion       an rlock of a rwmutex which may be read-held, when
+//	                     another process may write-lock it: the rlock blocks
+//	                     if the writer is waiting, and the writer waits for
+//	                     the first read lock to be released
+//	RUnlockWithoutRLock  a runlock of a rwmutex which may not be read-held
+//	LockUpgrade          a lock of a rwmutex which may be read-held, which
+//	                     blocks forever
+//
+// All branches are assumed feasible. Unlocks of a mutex locked by another
+// process are reported as UnlockUnlocked.
+func Mutexes(prog *migo.Program, opts Options) (*MutexResult, error) {
+	a, err := newStatic(prog, opts)
+	if err != nil {
+		return nil, err
+	}
+	m := &mutexes{
+		static:    a,
+		ids:       make(map[interface{}]int),
+		summaries: make(map[string]*lockSet),
+		reported:  make(map[string]bool),
+		order:     make(map[[2]int]map[*process]Op),
+		writers:   make(map[int][]*migo.Function),
+		res:       &MutexResult{},
+	}
+	for _, fn := range prog.Funcs { // ids in the order of declarations
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if subst.Declared(stmt) != "" {
+				m.id(stmt)
+			}
+		})
+	}
+	for _, fn := range prog.Funcs {
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if name := lockName(stmt); name != "" {
+				for _, id := range m.mutexIDs(fn, name) {
+					for _, r := range a.rootsOf[fn] {
+						m.writers[id] = appendFunc(m.writers[id], r)
+					}
+				}
+			}
+		})
+	}
+	m.spawn(a.roots[0], nil)
+	exits := make(map[*process]*lockSet)
+	for changed := true; changed; {
+		m.changed = false
+		m.computed = make(map[string]bool)
+		for i := 0; i < len(m.procs); i++ { // spawns append processes
+			m.root = m.procs[i]
+			exits[m.root] = m.call(m.root.fn, m.root.env, newLockSet())
+		}
+		changed = m.changed
+	}
+	for _, p := range m.procs {
+		if out := exits[p]; out != nil {
+			for _, id := range out.held() {
+				m.report(HeldAtExit, []int{id}, out.may[id])
+			}
+			for _, id := range out.readHeld() {
+				m.report(HeldAtExit, []int{id}, out.rmay[id])
+			}
+		}
+	}
+	m.lockOrder()
+	return m.res, nil
+}
+
+// lockSet is the mutexes held by a process at a statement,
+// where nil is the lock-set of unreachable statements.
+type lockSet struct {
+	may   map[int]Op   // Mutexes which may be held, with a lock which acquired it.
+	must  map[int]bool // Mutexes which must be held.
+	rmay  map[int]Op   // RWMutexes which may be read-held, with the first rlock.
+	rmust map[int]int  // Number of read locks of rwmutexes which must be held.
+}
+
+// maxReadLocks bounds the number of read locks of a rwmutex counted in
+// lock-sets, so that rlocks in loops reach a fixpoint.
+const maxReadLocks = 3
+
+func newLockSet() *lockSet {
+	return &lockSet{may: map[int]Op{}, must: map[int]bool{}, rmay: map[int]Op{}, rmust: map[int]int{}}
+}
+
+func (s *lockSet) copy() *lockSet {
+	c := &lockSet{
+		may:   make(map[int]Op, len(s.may)),
+		must:  make(map[int]bool, len(s.must)),
+		rmay:  make(map[int]Op, len(s.rmay)),
+		rmust: make(map[int]int, len(s.rmust)),
+	}
+	for k, v := range s.may {
+		c.may[k] = v
+	}
+	for k := range s.must {
+		c.must[k] = true
+	}
+	for k, v := range s.rmay {
+		c.rmay[k] = v
+	}
+	for k, v := range s.rmust {
+		c.rmust[k] = v
+	}
+	return c
+}
+
+// held returns the mutexes which may be held, sorted.
+func (s *lockSet) held() []int {
+	ids := make([]int, 0, len(s.may))
+	for id := range s.may {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// readHeld returns the rwmutexes which may be read-held, sorted.
+func (s *lockSet) readHeld() []int {
+	ids := make([]int, 0, len(s.rmay))
+	for id := range s.rmay {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (s *lockSet) key() string {
+	if s == nil {
+		return "⊥"
+	}
+	must := make([]int, 0, len(s.must))
+	for id := range s.must {
+		must = append(must, id)
+	}
+	sort.Ints(must)
+	rmust := make([]string, 0, len(s.rmust))
+	for _, id := range s.readHeld() {
+		rmust = append(rmust, fmt.Sprintf("%d:%d", id, s.rmust[id]))
+	}
+	return fmt.Sprint(s.held(), must, rmust)
+}
+
+// join returns the lock-set of either s or t.
+func join(s, t *lockSet) *lockSet {
+	if s == nil {
+		return t
+	}
+	if t == nil {
+		return s
+	}
+	j := s.copy()
+	for id, op := range t.may {
+		if _, ok := j.may[id]; !ok {
+			j.may[id] = op
+		}
+	}
+	for id := range j.must {
+		if !t.must[id] {
+			delete(j.must, id)
+		}
+	}
+	for id, op := range t.rmay {
+		if _, ok := j.rmay[id]; !ok {
+			j.rmay[id] = op
+		}
+	}
+	for id, n := range j.rmust {
+		if t.rmust[id] < n {
+			j.rmust[id] = t.rmust[id]
+		}
+		if j.rmust[id] == 0 {
+			delete(j.rmust, id)
+		}
+	}
+	return j
+}
+
+type mutexes struct {
+	*static
+	ids       map[interface{}]int // mutex site → id
+	sites     []interface{}       // id → mutex site
+	summaries map[string]*lockSet // function, binding and lock-set on entry → lock-set on exit
+	computed  map[string]bool     // summaries computed in this iteration
+	changed   bool                // whether a summary changed in this iteration
+	procs     []*process          // processes, entry first
+	root      *process            // process analysed
+	order     map[[2]int]map[*process]Op
+	writers   map[int][]*migo.Function // roots of processes which may write-lock each rwmutex
+	reported  map[string]bool
+	res       *MutexResult
+}
+
+// binding is the mutexes of the parameters of a function, where nil binds
+// none (the parameters of the entry function are globals).
+type binding map[string][]int
+
+// process is a root function with the binding of its parameters.
+type process struct {
+	fn  *migo.Function
+	env binding
+	key string
+}
+
+func (m *mutexes) id(site interface{}) int {
+	if id, ok := m.ids[site]; ok {
+		return id
+	}
+	m.ids[site] = len(m.sites)
+	m.sites = append(m.sites, site)
+	return m.ids[site]
+}
+
+// mutexIDs returns the ids of the mutexes of name in fn.
+func (m *mutexes) mutexIDs(fn *migo.Function, name string) []int {
+	var ids []int
+	for _, site := range m.static.sites(fn, name) {
+		ids = append(ids, m.id(site))
+	}
+	return ids
+}
+
+// resolve returns the ids of the mutexes of name in fn with binding env.
+func (m *mutexes) resolve(fn *migo.Function, env binding, name string) []int {
+	if ids, ok := env[name]; ok {
+		return ids
+	}
+	return m.mutexIDs(fn, name)
+}
+
+// bind returns the binding of the parameters of callee to the mutexes of
+// the arguments params in fn with binding env.
+func (m *mutexes) bind(fn *migo.Function, env binding, callee *migo.Function, params []*migo.Parameter) binding {
+	if len(callee.Params) != len(params) {
+		return nil
+	}
+	b := make(binding)
+	for i, p := range params {
+		b[callee.Params[i].Callee.Name()] = m.resolve(fn, env, p.Caller.Name())
+	}
+	return b
+}
+
+// bindingKey returns the key of binding env of the parameters of fn.
+func bindingKey(fn *migo.Function, env binding) string {
+	if env == nil {
+		return fn.Name
+	}
+	ids := make([][]int, len(fn.Params))
+	for i, p := range fn.Params {
+		ids[i] = env[p.Callee.Name()]
+	}
+	return fn.Name + fmt.Sprint(ids)
+}
+
+// spawn adds the process of root fn with binding env, if not added.
+func (m *mutexes) spawn(fn *migo.Function, env binding) {
+	key := bindingKey(fn, env)
+	for _, p := range m.procs {
+		if p.key == key {
+			return
+		}
+	}
+	m.procs = append(m.procs, &process{fn: fn, env: env, key: key})
+}
+
+func (m *mutexes) report(kind MutexKind, ids []int, ops ...Op) {
+	key := fmt.Sprint(kind, ids)
+	for _, op := range ops {
+		key += fmt.Sprintf(" %p", op.Stmt)
+	}
+	if m.reported[key] {
+		return
+	}
+	m.reported[key] = true
+	v := &MutexViolation{Kind: kind, Ops: ops}
+	for _, id := range ids {
+		v.Mutexes = append(v.Mutexes, siteName(m.sites[id]))
+	}
+	m.res.Violations = append(m.res.Violations, v)
+}
+
+// call returns the lock-set at the end of function fn called with binding
+// env and lock-set in, or nil if fn does not terminate.
+func (m *mutexes) call(fn *migo.Function, env binding, in *lockSet) *lockSet {
+	key := bindingKey(fn, env) + in.key()
+	if m.computed[key] {
+		return m.rebase(m.summaries[key], in)
+	}
+	m.computed[key] = true
+	out := m.stmts(fn, env, fn.Stmts, in)
+	if out.key() != m.summaries[key].key() {
+		m.summaries[key] = out
+		m.changed = true
+	}
+	return out
+}
+
+// rebase returns the lock-set out (of a summary) with the locks of the
+// mutexes held on entry taken from in.
+func (m *mutexes) rebase(out, in *lockSet) *lockSet {
+	if out == nil {
+		return nil
+	}
+	r := out.copy()
+	for id := range r.may {
+		if op, ok := in.may[id]; ok {
+			r.may[id] = op
+		}
+	}
+	for id := range r.rmay {
+		if op, ok := in.rmay[id]; ok {
+			r.rmay[id] = op
+		}
+	}
+	return r
+}
+
+func (m *mutexes) stmts(fn *migo.Function, env binding, stmts []migo.Statement, in *lockSet) *lockSet {
+	s := in
+	for _, stmt := range stmts {
+		if s == nil {
+			return nil
+		}
+		op := Op{Func: fn, Stmt: stmt}
+		switch stmt := stmt.(type) {
+		case *migo.SyncMutexLock, *migo.SyncRWMutexLock:
+			s = m.writeLock(s, m.resolve(fn, env, lockName(stmt)), op)
+		case *migo.SyncMutexUnlock:
+			s = m.unlock(s, m.resolve(fn, env, stmt.Name), op)
+		case *migo.SyncRWMutexUnlock:
+			s = m.unlock(s, m.resolve(fn, env, stmt.Name), op)
+		case *migo.SyncRWMutexRLock:
+			ids := m.resolve(fn, env, stmt.Name)
+			if len(ids) == 1 && s.must[ids[0]] {
+				m.report(DoubleLock, ids, op)
+				return nil // blocks forever
+			}
+			s = s.copy()
+			for _, id := range ids {
+				if _, held := s.may[id]; held {
+					m.report(DoubleLock, []int{id}, op)
+				}
+				if rop, held := s.rmay[id]; held && m.concurrentWriter(id) {
+					m.report(RLockRecursion, []int{id}, op, rop)
+				}
+			}
+			for _, id := range ids {
+				if _, held := s.rmay[id]; !held {
+					s.rmay[id] = op
+				}
+				if len(ids) == 1 && s.rmust[id] < maxReadLocks {
+					s.rmust[id]++
+				}
+			}
+		case *migo.SyncRWMutexRUnlock:
+			ids := m.resolve(fn, env, stmt.Name)
+			s = s.copy()
+			if len(ids) == 1 && s.rmust[ids[0]] == 0 {
+				m.report(RUnlockWithoutRLock, ids, op)
+			}
+			for _, id := range ids {
+				if s.rmust[id] > 0 {
+					s.rmust[id]--
+				}
+				if len(ids) == 1 && s.rmust[id] == 0 {
+					delete(s.rmust, id)
+					delete(s.rmay, id)
+				}
+			}
+		case *migo.CallStatement:
+			if callee, ok := m.prog.Function(stmt.Name); ok {
+				s = m.call(callee, m.bind(fn, env, callee, stmt.Params), s)
+			}
+		case *migo.SpawnStatement:
+			if callee, ok := m.prog.Function(stmt.Name); ok {
+				m.spawn(callee, m.bind(fn, env, callee, stmt.Params))
+			}
+		case *migo.IfStatement:
+			s = join(m.stmts(fn, env, stmt.Then, s), m.stmts(fn, env, stmt.Else, s))
+		case *migo.IfForStatement:
+			s = join(m.stmts(fn, env, stmt.Then, s), m.stmts(fn, env, stmt.Else, s))
+		case *migo.SelectStatement:
+			var out *lockSet
+			for _, c := range stmt.Cases {
+				out = join(out, m.stmts(fn, env, c, s))
+			}
+			if len(stmt.Cases) > 0 {
+				s = out
+			} else {
+				s = nil // blocks forever
+			}
+		}
+	}
+	return s
+}
+
+// writeLock returns lock-set s after a lock by op of the mutexes or
+// rwmutexes ids, which blocks forever if a rwmutex must be read-held.
+func (m *mutexes) writeLock(s *lockSet, ids []int, op Op) *lockSet {
+	for _, id := range ids {
+		if rop, held := s.rmay[id]; held {
+			m.report(LockUpgrade, []int{id}, op, rop)
+		}
+	}
+	if len(ids) == 1 && s.rmust[ids[0]] > 0 {
+		return nil // blocks forever
+	}
+	return m.lock(s, ids, op)
+}
+
+// lockName returns the name of lock statement stmt (of a mutex or the write
+// lock of a rwmutex), or "" if stmt is not a lock.
+func lockName(stmt migo.Statement) string {
+	switch stmt := stmt.(type) {
+	case *migo.SyncMutexLock:
+		return stmt.Name
+	case *migo.SyncRWMutexLock:
+		return stmt.Name
+	}
+	return ""
+}
+
+// lock returns lock-set s after a lock by op of the mutexes ids.
+func (m *mutexes) lock(s *lockSet, ids []int, op Op) *lockSet {
+	if len(ids) == 1 && s.must[ids[0]] {
+		m.report(DoubleLock, ids, op)
+		return nil // blocks forever
+	}
+	s = s.copy()
+	for _, id := range ids {
+		if _, held := s.may[id]; held {
+			m.report(DoubleLock, []int{id}, op)
+		}
+		for _, h := range s.held() {
+			if h != id {
+				m.recordOrder(h, id, op)
+			}
+		}
+	}
+	for _, id := range ids {
+		if _, held := s.may[id]; !held {
+			s.may[id] = op
+		}
+		if len(ids) == 1 {
+			s.must[id] = true
+		}
+	}
+	return s
+}
+
+// unlock returns lock-set s after an unlock by op of the mutexes ids.
+func (m *mutexes) unlock(s *lockSet, ids []int, op Op) *lockSet {
+	s = s.copy()
+	if len(ids) == 1 && !s.must[ids[0]] {
+		m.report(UnlockUnlocked, ids, op)
+	}
+	for _, id := range ids {
+		delete(s.must, id)
+		if len(ids) == 1 {
+			delete(s.may, id)
+		}
+	}
+	return s
+}
+
+// concurrentWriter returns true if rwmutex id may be write-locked by a
+// process other than the one analysed.
+func (m *mutexes) concurrentWriter(id int) bool {
+	for _, r := range m.writers[id] {
+		if r != m.root.fn || m.multi[r] {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOrder records that mutex second is locked by op while holding first.
+func (m *mutexes) recordOrder(first, second int, op Op) {
+	k := [2]int{first, second}
+	if m.order[k] == nil {
+		m.order[k] = make(map[*process]Op)
+	}
+	if _, ok := m.order[k][m.root]; !ok {
+		m.order[k][m.root] = op
+	}
+}
+
+// lockOrder reports the pairs of mutexes locked in both orders.
+func (m *mutexes) lockOrder() {
+	for _, p1 := range m.procs {
+		for first := range m.sites {
+			for second := first + 1; second < len(m.sites); second++ {
+				op1, ok := m.order[[2]int{first, second}][p1]
+				if !ok {
+					continue
+				}
+				for _, p2 := range m.procs {
+					op2, ok := m.order[[2]int{second, first}][p2]
+					if ok && (p1 != p2 || m.multi[p1.fn]) {
+						m.report(LockOrder, []int{first, second}, op1, op2)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package check_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/check"
+)
+
+func TestMutexes(t *testing.T) {
+	tests := []struct {
+		name       string
+		prog       string
+		violations []string
+	}{
+		{
+			name: "correct",
+			prog: `def main(): letsync m mutex; spawn f(m); call f(m);
+def f(x): lock x; write v; unlock x;`,
+		},
+		{
+			name: "double lock",
+			prog: `def main(): letsync m mutex; lock m; call f(m); unlock m;
+def f(x): lock x; unlock x;`,
+			violations: []string{"double lock m: lock x (f:1)"},
+		},
+		{
+			name:       "unlock unlocked",
+			prog:       `def main(): letsync m mutex; if lock m; else tau; endif; unlock m;`,
+			violations: []string{"unlock of unlocked mutex m: unlock m (main:3)"},
+		},
+		{
+			name: "held at exit",
+			prog: `def main(): letsync m mutex; spawn f(m);
+def f(x): lock x; select case recv c; unlock x; case tau; endselect;`,
+			violations: []string{"mutex held at exit m: lock x (f:1)"},
+		},
+		{
+			name: "lock order",
+			prog: `def main(): letsync a mutex; letsync b mutex; spawn f(a, b); call g(a, b);
+def f(x, y): lock x; lock y; unlock y; unlock x;
+def g(x, y): lock y; call h(x); unlock y;
+def h(x): lock x; unlock x;`,
+			violations: []string{"lock order inversion a, b: lock y (f:2), lock x (h:1)"},
+		},
+		{
+			name: "same order",
+			prog: `def main(): letsync a mutex; letsync b mutex; spawn f(a, b); call f(a, b);
+def f(x, y): lock x; lock y; unlock y; unlock x;`,
+		},
+		{
+			name: "recursion",
+			prog: `def main(): letsync m mutex; call loop(m);
+def loop(x): if lock x; unlock x; call loop(x); else tau; endif;`,
+		},
+		{
+			name: "lock in loop",
+			prog: `def main(): letsync m mutex; call loop(m);
+def loop(x): if lock x; call loop(x); else tau; endif;`,
+			violations: []string{
+				"double lock m: lock x (loop:1/then:1)",
+				"mutex held at exit m: lock x (loop:1/then:1)",
+			},
+		},
+		{
+			name: "helper",
+			prog: `def main(): letsync m mutex; letsync r mutex; call f(m); call f(r);
+def f(x): lock x; unlock x;`,
+		},
+		{
+			name: "lock order by arguments",
+			prog: `def main(): letsync a mutex; letsync b mutex; spawn w(a, b); spawn w(b, a);
+def w(x, y): lock x; lock y; unlock y; unlock x;`,
+			violations: []string{"lock order inversion a, b: lock y (w:2), lock y (w:2)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.Mutexes(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range res.Violations {
+				got = append(got, v.String())
+			}
+			if want, got := strings.Join(test.violations, "\n"), strings.Join(got, "\n"); want != got {
+				t.Errorf("expected violations\n%s\nbut got\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestRWMutexes(t *testing.T) {
+	tests := []struct {
+		name       string
+		prog       string
+		violations []string
+	}{
+		{
+			name: "correct",
+			prog: `def main(): letsync m rwmutex; spawn w(m); call r(m); call r(m);
+def r(x): rlock x; read v; runlock x;
+def w(x): lock x; write v; unlock x;`,
+		},
+		{
+			name: "recursive rlock with writer",
+			prog: `def main(): letsync m rwmutex; spawn w(m); rlock m; call r(m); runlock m;
+def r(x): rlock x; runlock x;
+def w(x): lock x; unlock x;`,
+			violations: []string{"recursive read lock m: rlock x (r:1), rlock m (main:3)"},
+		},
+		{
+			name: "recursive rlock without writer",
+			prog: `def main(): letsync m rwmutex; rlock m; rlock m; runlock m; runlock m;`,
+		},
+		{
+			name:       "runlock without rlock",
+			prog:       `def main(): letsync m rwmutex; rlock m; runlock m; runlock m;`,
+			violations: []string{"runlock without rlock m: runlock m (main:4)"},
+		},
+		{
+			name: "upgrade",
+			prog: `def main(): letsync m rwmutex; call f(m);
+def f(x): rlock x; lock x; unlock x; runlock x;`,
+			violations: []string{"lock upgrade m: lock x (f:2), rlock x (f:1)"},
+		},
+		{
+			name:       "rlock while write-locked",
+			prog:       `def main(): letsync m rwmutex; lock m; rlock m; runlock m; unlock m;`,
+			violations: []string{"double lock m: rlock m (main:3)"},
+		},
+		{
+			name: "read lock held at exit",
+			prog: `def main(): letsync m rwmutex; spawn f(m);
+def f(x): rlock x;`,
+			violations: []string{"mutex held at exit m: rlock x (f:1)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.Mutexes(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range res.Violations {
+				got = append(got, v.String())
+			}
+			if want, got := strings.Join(test.violations, "\n"), strings.Join(got, "\n"); want != got {
+				t.Errorf("expected violations\n%s\nbut got\n%s", want, got)
+			}
+		})
+	}
+}
+
+// The misuses found by Mutexes deadlock in the semantics.
+func TestRWMutexDeadlocks(t *testing.T) {
+	for _, prog := range []string{
+		`def main(): letsync m rwmutex; rlock m; lock m; unlock m; runlock m;`,
+		`def main(): letsync m rwmutex; spawn w(m); rlock m; tau; rlock m; runlock m; runlock m;
+def w(x): lock x; unlock x;`,
+	} {
+		res, err := check.Deadlocks(parse(t, prog), check.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Deadlocks) == 0 {
+			t.Errorf("expected deadlock in %s", prog)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+// Race is a pair of conflicting accesses (read and write, or two writes) to
+// a memory location by different processes, which are not ordered by
+// happens-before and not protected by a common mutex.
+type Race struct {
+	Mem  string // Name of the memory location when created.
+	Pids []int  // PIDs of the processes of the accesses.
+	Ops  []Op   // The first and second access.
+
+	// Traces are the traces to each access in Ops, on the same execution:
+	// the trace to the first access is a prefix of the trace to the second.
+	Traces []Trace
+}
+
+func (r *Race) String() string {
+	s := fmt.Sprintf("race on %s: %d@%s (%s), %d@%s (%s)\n", r.Mem,
+		r.Pids[0], r.Ops[0], r.Ops[0].Pos(), r.Pids[1], r.Ops[1], r.Ops[1].Pos())
+	for i, tr := range r.Traces {
+		s += fmt.Sprintf("  trace to %s:\n%s", r.Ops[i], tr)
+	}
+	return s
+}
+
+// RaceResult is the result of Races.
+type RaceResult struct {
+	Races    []*Race // At most one per pair of statements.
+	States   int     // Number of configurations explored.
+	Complete bool    // Whether all reachable configurations are explored.
+}
+
+// Races returns the data races on memory locations of Program prog.
+func Races(prog *migo.Program, opts Options) (*RaceResult, error) {
+	g, err := Explore(prog, opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.Races(), nil
+}
+
+// Races returns the data races on memory locations in the state graph.
+//
+// The accesses are checked on the path of each state given by Trace, i.e.
+// on an execution reaching every explored configuration, with a hybrid of
+// happens-before and lock sets. Happens-before is tracked with vector
+// clocks, ordered by
+//
+//	spawn        the statements of the parent before the spawn and of
+//	             the child
+//	send, recv   a send and its receive (the matching send in the buffer
+//	             for buffered channels), the k-th receive and the (k+C)-th
+//	             send of a buffered channel of capacity C (the send reuses
+//	             the slot freed by the receive), and a close and a receive
+//	             of the closed channel
+//
+// and the mutexes held by each process are tracked as lock sets, where a
+// rwmutex protects the accesses if one of them holds its write lock. Two
+// accesses race if they are not ordered and not protected.
+//
+// As the accesses happen on the same execution, a race is found if both
+// accesses are in an explored configuration; the happens-before order may
+// depend on the execution, e.g. which sender a receive matches.
+func (g *Graph) Races() *RaceResult {
+	res := &RaceResult{States: len(g.States), Complete: g.Complete}
+	reported := make(map[[2]migo.Statement]bool)
+	hb := make(map[*State]*hbState, len(g.States))
+	depth := make(map[*State]int, len(g.States))
+	for _, s := range g.States { // parents before children
+		if s.parent == nil {
+			hb[s] = newHBState()
+			continue
+		}
+		l := s.parent.Edges[s.label].Label
+		depth[s] = depth[s.parent] + 1
+		var races []access
+		hb[s], races = hb[s.parent].step(s.parent.Config, l, depth[s])
+		for _, a := range races {
+			op := Op{Func: l.Funcs[0], Stmt: l.Stmts[0]}
+			key := [2]migo.Statement{a.op.Stmt, op.Stmt}
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+			reported[[2]migo.Statement{op.Stmt, a.op.Stmt}] = true
+			tr := g.Trace(s)
+			res.Races = append(res.Races, &Race{
+				Mem:    s.Config.ResourceName(l.Res),
+				Pids:   []int{a.pid, l.Pids[0]},
+				Ops:    []Op{a.op, op},
+				Traces: []Trace{tr[:a.step:a.step], tr},
+			})
+		}
+	}
+	return res
+}
+
+// vclock is a vector clock, indexed by thread, i.e. process instance
+// (a PID may be reused by processes spawned after the end of another).
+// Vector clocks are not modified once created.
+type vclock map[int]int
+
+// join returns the least upper bound of v and w.
+func (v vclock) join(w vclock) vclock {
+	j := make(vclock, len(v))
+	for t, c := range v {
+		j[t] = c
+	}
+	for t, c := range w {
+		if c > j[t] {
+			j[t] = c
+		}
+	}
+	return j
+}
+
+// tick returns v with the clock of thread t incremented.
+func (v vclock) tick(t int) vclock {
+	n := v.join(nil)
+	n[t]++
+	return n
+}
+
+// access is an access to a memory location.
+type access struct {
+	pid    int
+	thread int
+	clock  int // clock of thread at the access
+	write  bool
+	locks  map[semantics.ID]bool // locks held, true if write-locked
+	op     Op
+	step   int // length of the trace to the access
+}
+
+// hbState is the happens-before state at the end of a path. The maps are
+// copied on write.
+type hbState struct {
+	threads  map[int]int                   // PID → thread
+	clocks   map[int]vclock                // thread → clock
+	locks    map[int]map[semantics.ID]bool // thread → locks held, true if write-locked
+	buffers  map[semantics.ID][]vclock     // clocks of the sends in channel buffers
+	freed    map[semantics.ID][]vclock     // clocks of the receives of slots not reused by a send
+	closed   map[semantics.ID]vclock       // clocks of channel closes
+	accesses map[semantics.ID][]access     // accesses of memory locations
+	next     int                           // next thread
+}
+
+func newHBState() *hbState {
+	return &hbState{
+		threads:  map[int]int{0: 0},
+		clocks:   map[int]vclock{0: {0: 1}},
+		locks:    map[int]map[semantics.ID]bool{},
+		buffers:  map[semantics.ID][]vclock{},
+		freed:    map[semantics.ID][]vclock{},
+		closed:   map[semantics.ID]vclock{},
+		accesses: map[semantics.ID][]access{},
+		next:     1,
+	}
+}
+
+func (h *hbState) clone() *hbState {
+	n := &hbState{
+		threads:  make(map[int]int, len(h.threads)),
+		clocks:   make(map[int]vclock, len(h.clocks)),
+		locks:    make(map[int]map[semantics.ID]bool, len(h.locks)),
+		buffers:  make(map[semantics.ID][]vclock, len(h.buffers)),
+		freed:    make(map[semantics.ID][]vclock, len(h.freed)),
+		closed:   make(map[semantics.ID]vclock, len(h.closed)),
+		accesses: make(map[semantics.ID][]access, len(h.accesses)),
+		next:     h.next,
+	}
+	for k, v := range h.threads {
+		n.threads[k] = v
+	}
+	for k, v := range h.clocks {
+		n.clocks[k] = v
+	}
+	for k, v := range h.locks {
+		n.locks[k] = v
+	}
+	for k, v := range h.buffers {
+		n.buffers[k] = v
+	}
+	for k, v := range h.freed {
+		n.freed[k] = v
+	}
+	for k, v := range h.closed {
+		n.closed[k] = v
+	}
+	for k, v := range h.accesses {
+		n.accesses[k] = v
+	}
+	return n
+}
+
+// step returns the state after transition l from configuration cfg, where
+// the trace to the transition has length step, with the earlier accesses
+// racing with the access of l.
+func (h *hbState) step(cfg *semantics.Config, l semantics.Label, step int) (*hbState, []access) {
+	n := h.clone()
+	if l.Panic != "" {
+		return n, nil
+	}
+	var races []access
+	t := n.threads[l.Pids[0]]
+	switch l.Kind {
+	case semantics.Spawn:
+		child := n.next
+		n.next++
+		n.threads[l.Spawned] = child
+		n.clocks[child] = n.clocks[t].tick(child)
+		delete(n.locks, child)
+	case semantics.Sync:
+		u := n.threads[l.Pids[1]]
+		j := n.clocks[t].join(n.clocks[u])
+		n.clocks[u] = j.tick(u)
+		n.clocks[t] = j
+	case semantics.Send:
+		buf, freed := n.buffers[l.Res], n.freed[l.Res]
+		if ch, ok := cfg.Chans[l.Res]; ok && len(freed) > 0 && len(buf)+len(freed) >= ch.Cap {
+			n.clocks[t] = n.clocks[t].join(freed[0])
+			n.freed[l.Res] = freed[1:]
+		}
+		n.buffers[l.Res] = append(buf[:len(buf):len(buf)], n.clocks[t])
+	case semantics.Recv:
+		if ch, ok := cfg.Chans[l.Res]; ok && ch.Len > 0 {
+			if buf := n.buffers[l.Res]; len(buf) > 0 {
+				n.clocks[t] = n.clocks[t].join(buf[0])
+				n.buffers[l.Res] = buf[1:]
+				freed := n.freed[l.Res]
+				n.freed[l.Res] = append(freed[:len(freed):len(freed)], n.clocks[t])
+			}
+		} else {
+			n.clocks[t] = n.clocks[t].join(n.closed[l.Res])
+		}
+	case semantics.Close:
+		n.closed[l.Res] = n.clocks[t]
+	case semantics.Lock, semantics.RLock:
+		n.lock(t, l.Res, l.Kind == semantics.Lock)
+	case semantics.Unlock, semantics.RUnlock:
+		n.unlock(t, l.Res)
+	case semantics.Read, semantics.Write:
+		a := access{
+			pid:    l.Pids[0],
+			thread: t,
+			clock:  n.clocks[t][t],
+			write:  l.Kind == semantics.Write,
+			locks:  n.locks[t],
+			op:     Op{Func: l.Funcs[0], Stmt: l.Stmts[0]},
+			step:   step,
+		}
+		var accesses []access
+		for _, b := range n.accesses[l.Res] {
+			if b.thread == t && b.op.Stmt == a.op.Stmt {
+				continue // replaced by a
+			}
+			accesses = append(accesses, b)
+			if b.thread != t && (a.write || b.write) && b.clock > n.clocks[t][b.thread] && !protected(a.locks, b.locks) {
+				races = append(races, b)
+			}
+		}
+		n.accesses[l.Res] = append(accesses, a)
+	}
+	n.clocks[t] = n.clocks[t].tick(t)
+	return n, races
+}
+
+func (h *hbState) lock(t int, id semantics.ID, write bool) {
+	locks := make(map[semantics.ID]bool, len(h.locks[t])+1)
+	for k, v := range h.locks[t] {
+		locks[k] = v
+	}
+	locks[id] = write
+	h.locks[t] = locks
+}
+
+func (h *hbState) unlock(t int, id semantics.ID) {
+	locks := make(map[semantics.ID]bool, len(h.locks[t]))
+	for k, v := range h.locks[t] {
+		if k != id {
+			locks[k] = v
+		}
+	}
+	h.locks[t] = locks
+}
+
+// protected returns true if lock sets a and b have a common lock,
+// write-locked in a or b.
+func protected(a, b map[semantics.ID]bool) bool {
+	for id, write := range a {
+		if w, ok := b[id]; ok && (write || w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package check_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/check"
+)
+
+func TestRaces(t *testing.T) {
+	tests := []struct {
+		name  string
+		prog  string
+		races []string
+	}{
+		{
+			name: "unordered",
+			prog: `def main(): letmem v; spawn f(v); read v;
+def f(x): write x;`,
+			races: []string{"race on v: 0@main: read v (main:3), 1@f: write x (f:1)"},
+		},
+		{
+			name: "reads",
+			prog: `def main(): letmem v; spawn f(v); read v;
+def f(x): read x;`,
+		},
+		{
+			name: "spawn",
+			prog: `def main(): letmem v; write v; spawn f(v);
+def f(x): write x;`,
+		},
+		{
+			name: "sync",
+			prog: `def main(): letmem v; let ch = newchan ch, 0; spawn f(v, ch); recv ch; read v;
+def f(x, c): write x; send c;`,
+		},
+		{
+			name: "buffered",
+			prog: `def main(): letmem v; let ch = newchan ch, 1; spawn f(v, ch); recv ch; read v;
+def f(x, c): write x; send c;`,
+		},
+		{
+			name: "buffered send before write",
+			prog: `def main(): letmem v; let ch = newchan ch, 1; spawn f(v, ch); recv ch; read v;
+def f(x, c): send c; write x;`,
+			races: []string{"race on v: 1@f: write x (f:2), 0@main: read v (main:5)"},
+		},
+		{
+			name: "semaphore",
+			prog: `def main(): letmem v; let s = newchan s, 1; spawn f(v, s); call f(v, s);
+def f(x, s): send s; write x; recv s;`,
+		},
+		{
+			name: "close",
+			prog: `def main(): letmem v; let ch = newchan ch, 0; spawn f(v, ch); recv ch; write v;
+def f(x, c): write x; close c;`,
+		},
+		{
+			name: "mutex",
+			prog: `def main(): letmem v; letsync m mutex; spawn f(v, m); call f(v, m);
+def f(x, y): lock y; write x; unlock y;`,
+		},
+		{
+			name: "mutex and rwmutex through shared callee",
+			prog: `def main(): letmem v; letsync m mutex; letsync r rwmutex; call f(v, r); spawn f(v, m); call f(v, m);
+def f(x, y): lock y; write x; unlock y;`,
+		},
+		{
+			name: "read locks",
+			prog: `def main(): letmem v; letsync m rwmutex; spawn f(v, m); rlock m; write v; runlock m;
+def f(x, y): rlock y; write x; runlock y;`,
+			races: []string{"race on v: 0@main: write v (main:5), 1@f: write x (f:2)"},
+		},
+		{
+			name: "read and write locks",
+			prog: `def main(): letmem v; letsync m rwmutex; spawn f(v, m); rlock m; read v; runlock m;
+def f(x, y): lock y; write x; unlock y;`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.Races(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.Complete {
+				t.Error("expected complete exploration")
+			}
+			var got []string
+			for _, r := range res.Races {
+				got = append(got, strings.SplitN(r.String(), "\n", 2)[0])
+			}
+			if want, got := strings.Join(test.races, "\n"), strings.Join(got, "\n"); want != got {
+				t.Errorf("expected races\n%s\nbut got\n%s", want, got)
+			}
+		})
+	}
+}
+
+// The traces of a race are the paths to both accesses on the same execution.
+func TestRaceTrace(t *testing.T) {
+	res, err := check.Races(parse(t, `def main(): letmem v; spawn f(v); read v;
+def f(x): write x;`), check.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(res.Races); want != got {
+		t.Fatalf("expected %d race but got %d", want, got)
+	}
+	want := `race on v: 0@main: read v (main:3), 1@f: write x (f:1)
+  trace to main: read v:
+  1. newmem [0@main: letmem v]
+  2. spawn [0@main: spawn f(v)]
+  3. read [0@main: read v]
+  trace to f: write x:
+  1. newmem [0@main: letmem v]
+  2. spawn [0@main: spawn f(v)]
+  3. read [0@main: read v]
+  4. write [1@f: write x]
+`
+	if got := res.Races[0].String(); want != got {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
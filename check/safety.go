@@ -0,0 +1,241 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+// SafetyKind is the kind of a channel safety violation.
+type SafetyKind int
+
+const (
+	SendOnClosed SafetyKind = iota // Send on a closed channel.
+	DoubleClose                    // Close of a closed channel.
+	MultiClose                     // Channel closed by more than one process.
+)
+
+func (k SafetyKind) String() string {
+	switch k {
+	case SendOnClosed:
+		return "send on closed channel"
+	case DoubleClose:
+		return "double close"
+	case MultiClose:
+		return "closed by multiple processes"
+	}
+	return fmt.Sprintf("SafetyKind(%d)", int(k))
+}
+
+// Op is a statement in a function.
+type Op struct {
+	Func *migo.Function
+	Stmt migo.Statement
+}
+
+func (o Op) String() string {
+	return fmt.Sprintf("%s: %s", o.Func.Name, o.Stmt)
+}
+
+// Pos returns the position of the statement in the function, i.e. the
+// function name followed by the (1-based) index of the statement, with the
+// index of the enclosing statements and branches if nested, e.g.
+//
+//	main:2           second statement of main
+//	f:3/then:1       first statement of the then branch of the third statement of f
+//	f:1/case2:1      first statement (guard) of the second case of a select
+//
+// The statement is compared by identity, and Pos returns the function name
+// if it is not found.
+func (o Op) Pos() string {
+	if path, ok := position(o.Func.Stmts, o.Stmt); ok {
+		return o.Func.Name + ":" + path
+	}
+	return o.Func.Name
+}
+
+func position(stmts []migo.Statement, target migo.Statement) (string, bool) {
+	for i, stmt := range stmts {
+		if stmt == target {
+			return fmt.Sprint(i + 1), true
+		}
+		var blocks [][]migo.Statement
+		var names []string
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			blocks, names = [][]migo.Statement{stmt.Then, stmt.Else}, []string{"then", "else"}
+		case *migo.IfForStatement:
+			blocks, names = [][]migo.Statement{stmt.Then, stmt.Else}, []string{"then", "else"}
+		case *migo.SelectStatement:
+			blocks = stmt.Cases
+			for j := range stmt.Cases {
+				names = append(names, fmt.Sprintf("case%d", j+1))
+			}
+		}
+		for j, block := range blocks {
+			if path, ok := position(block, target); ok {
+				return fmt.Sprintf("%d/%s:%s", i+1, names[j], path), true
+			}
+		}
+	}
+	return "", false
+}
+
+// SafetyViolation is an unsafe use of a channel.
+type SafetyViolation struct {
+	Kind SafetyKind
+	Chan string // Name of the channel when created.
+	Ops  []Op   // Statements of the violation.
+
+	// Traces are the traces to each statement in Ops
+	// (only for violations found by exploration).
+	Traces []Trace
+}
+
+func (v *SafetyViolation) String() string {
+	ops := make([]string, len(v.Ops))
+	for i, op := range v.Ops {
+		ops[i] = op.String()
+	}
+	s := fmt.Sprintf("%s %s: %s\n", v.Kind, v.Chan, strings.Join(ops, ", "))
+	for i, tr := range v.Traces {
+		s += fmt.Sprintf("  trace to %s:\n%s", v.Ops[i], tr)
+	}
+	return s
+}
+
+// SafetyResult is the result of Safety and StaticSafety.
+type SafetyResult struct {
+	Violations []*SafetyViolation
+	States     int  // Number of configurations explored (0 if static).
+	Complete   bool // Whether all reachable configurations are explored.
+}
+
+// Safety returns the unsafe uses of channels in Program prog: reachable
+// sends on closed channels, double closes, and channels closed by more
+// than one process (in the same or different executions).
+func Safety(prog *migo.Program, opts Options) (*SafetyResult, error) {
+	g, err := Explore(prog, opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.Safety(), nil
+}
+
+// Safety returns the unsafe uses of channels in the state graph.
+//
+// Channels are identified by their newchan statement (or name if global),
+// so processes closing different channels created by the same statement
+// are reported as closing the same channel. Processes are identified by
+// their chain of spawn statements (see procNames), as PIDs are reused and
+// depend on the execution.
+func (g *Graph) Safety() *SafetyResult {
+	res := &SafetyResult{States: len(g.States), Complete: g.Complete}
+	reported := make(map[migo.Statement]bool)
+	type closer struct {
+		op    Op
+		trace Trace
+	}
+	closers := make(map[interface{}]map[string]closer) // channel → process → first close
+	var chans []interface{}
+	names := make(map[interface{}]string)
+	procs := make(map[*State]*procNames, len(g.States))
+	for _, s := range g.States { // parents before children
+		if s.parent == nil {
+			procs[s] = &procNames{names: map[int]string{0: ""}, spawns: map[string]int{}}
+		} else {
+			procs[s] = procs[s.parent].step(s.parent.Edges[s.label].Label)
+		}
+		for _, e := range s.Edges {
+			l := e.Label
+			ch, ok := s.Config.Chans[l.Res]
+			if !ok || (l.Kind != semantics.Send && l.Kind != semantics.Close) {
+				continue
+			}
+			op := Op{Func: l.Funcs[0], Stmt: l.Stmts[0]}
+			if l.Panic != "" {
+				if reported[op.Stmt] {
+					continue
+				}
+				reported[op.Stmt] = true
+				kind := SendOnClosed
+				if l.Kind == semantics.Close {
+					kind = DoubleClose
+				}
+				res.Violations = append(res.Violations, &SafetyViolation{
+					Kind:   kind,
+					Chan:   ch.Name,
+					Ops:    []Op{op},
+					Traces: []Trace{append(g.Trace(s), l)},
+				})
+				continue
+			}
+			if l.Kind == semantics.Close {
+				var key interface{} = ch.Name
+				if ch.Decl != nil {
+					key = ch.Decl
+				}
+				if closers[key] == nil {
+					closers[key] = make(map[string]closer)
+					chans = append(chans, key)
+					names[key] = ch.Name
+				}
+				proc := procs[s].names[l.Pids[0]]
+				if _, seen := closers[key][proc]; !seen {
+					closers[key][proc] = closer{op: op, trace: append(g.Trace(s), l)}
+				}
+			}
+		}
+	}
+	for _, key := range chans {
+		if len(closers[key]) < 2 {
+			continue
+		}
+		procs := make([]string, 0, len(closers[key]))
+		for proc := range closers[key] {
+			procs = append(procs, proc)
+		}
+		sort.Strings(procs)
+		v := &SafetyViolation{Kind: MultiClose, Chan: names[key]}
+		for _, proc := range procs {
+			v.Ops = append(v.Ops, closers[key][proc].op)
+			v.Traces = append(v.Traces, closers[key][proc].trace)
+		}
+		res.Violations = append(res.Violations, v)
+	}
+	return res
+}
+
+// procNames is the names of the processes of a configuration, which
+// identify the processes across executions: the entry process is named "",
+// and a spawned process by the name of its parent, the position of the
+// spawn statement and the number of processes spawned before by the
+// statement in the parent, e.g. /main:3#0/f:1#0.
+type procNames struct {
+	names  map[int]string // PID → name
+	spawns map[string]int // parent name and spawn position → number of spawns
+}
+
+// step returns the names after transition l. The maps are copied on write.
+func (p *procNames) step(l semantics.Label) *procNames {
+	if l.Kind != semantics.Spawn || l.Panic != "" {
+		return p
+	}
+	n := &procNames{
+		names:  make(map[int]string, len(p.names)+1),
+		spawns: make(map[string]int, len(p.spawns)+1),
+	}
+	for k, v := range p.names {
+		n.names[k] = v
+	}
+	for k, v := range p.spawns {
+		n.spawns[k] = v
+	}
+	site := n.names[l.Pids[0]] + "/" + Op{Func: l.Funcs[0], Stmt: l.Stmts[0]}.Pos()
+	n.names[l.Spawned] = fmt.Sprintf("%s#%d", site, n.spawns[site])
+	n.spawns[site]++
+	return n
+}
@@ -0,0 +1,141 @@
+package check_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/check"
+)
+
+var safetyTests = []struct {
+	name    string
+	prog    string
+	dynamic []string
+	static  []string
+}{
+	{
+		name: "sender closes",
+		prog: `def main(): let ch = newchan ch, 0; spawn p(ch); recv ch; recv ch;
+def p(c): send c; close c;`,
+	},
+	{
+		name: "send on closed",
+		prog: `def main(): let ch = newchan ch, 1; spawn p(ch); close ch;
+def p(c): send c;`,
+		dynamic: []string{"send on closed channel ch: p: send c"},
+		static:  []string{"send on closed channel ch: p: send c"},
+	},
+	{
+		name: "double close",
+		prog: `def main(): let ch = newchan ch, 0; spawn c(ch); close ch;
+def c(x): close x;`,
+		dynamic: []string{
+			"double close ch: c: close x",
+			"double close ch: main: close ch",
+			"closed by multiple processes ch: main: close ch, c: close x",
+		},
+		static: []string{
+			"double close ch: main: close ch, c: close x",
+			"closed by multiple processes ch: main: close ch, c: close x",
+		},
+	},
+	{
+		// The closing process gets a different PID depending on whether
+		// h has terminated when it is spawned.
+		name: "single closer with reused pid",
+		prog: `def main(): let c = newchan c, 1; spawn f(c); spawn h(c);
+def f(c): spawn g(c);
+def g(c): close c;
+def h(c): tau;`,
+	},
+	{
+		name: "close in loop",
+		prog: `def main(): let ch = newchan ch, 0; call loop(ch);
+def loop(x): if close x; call loop(x); else tau; endif;`,
+		dynamic: []string{"double close ch: loop: close x"},
+		static:  []string{"double close ch: loop: close x"},
+	},
+	{
+		name: "close called from loop",
+		prog: `def main(): let c = newchan c, 0; call loop(c);
+def loop(c): call g(c); call loop(c);
+def g(c): close c;`,
+		dynamic: []string{"double close c: g: close c"},
+		static:  []string{"double close c: g: close c"},
+	},
+	{
+		name: "close called twice",
+		prog: `def main(): let c = newchan c, 0; call f(c); call f(c);
+def f(x): close x;`,
+		dynamic: []string{"double close c: f: close x"},
+		static:  []string{"double close c: f: close x"},
+	},
+	{
+		// Static analysis over-approximates: the send always precedes
+		// the close, but in different functions.
+		name: "sequential",
+		prog: `def main(): let ch = newchan ch, 1; call s(ch); close ch; recv ch;
+def s(x): send x;`,
+		static: []string{"send on closed channel ch: s: send x"},
+	},
+}
+
+func summary(vs []*check.SafetyViolation) string {
+	var lines []string
+	for _, v := range vs {
+		lines = append(lines, strings.SplitN(v.String(), "\n", 2)[0])
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSafety(t *testing.T) {
+	for _, test := range safetyTests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.Safety(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := strings.Join(test.dynamic, "\n"), summary(res.Violations); want != got {
+				t.Errorf("expected violations\n%s\nbut got\n%s", want, got)
+			}
+			for _, v := range res.Violations {
+				if want, got := len(v.Ops), len(v.Traces); want != got {
+					t.Errorf("expected %d traces but got %d", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticSafety(t *testing.T) {
+	for _, test := range safetyTests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := check.StaticSafety(parse(t, test.prog), check.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := strings.Join(test.static, "\n"), summary(res.Violations); want != got {
+				t.Errorf("expected violations\n%s\nbut got\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestSafetyTrace(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 1; spawn p(ch); close ch;
+def p(c): send c;`)
+	res, err := check.Safety(prog, check.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `send on closed channel ch: p: send c
+  trace to p: send c:
+  1. newchan [0@main: let ch = newchan ch, 1]
+  2. spawn [0@main: spawn p(ch)]
+  3. close [0@main: close ch]
+  4. send [1@p: send c] panic: send on closed channel ch
+`
+	if got := res.Violations[0].String(); want != got {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
@@ -0,0 +1,370 @@
+package check
+
+import (
+	"sort"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+// StaticSafety returns the possibly unsafe uses of channels in Program prog
+// without exploring its state space. It over-approximates Safety, i.e. it
+// may report violations which are not reachable, but is cheap enough for
+// programs too big to explore.
+//
+// Channels are identified by their newchan statement (or name if global),
+// and followed through parameters of calls and spawns regardless of scope.
+// The processes are approximated by their root function (the entry function
+// or a spawned function) with the functions called from it; a function in a
+// cycle of calls, or called at more than one call site in a process, or
+// called from such a function, may run more than once in a process, and a
+// root spawned by more than one spawn statement, or in a function
+// which may run more than once, may run in more than one process. Then for
+// each channel:
+//
+//	DoubleClose   if there are two closes, or a close which may run more
+//	              than once (in a process or in more than one process)
+//	MultiClose    if the closes may run in more than one process
+//	SendOnClosed  for each send which may run concurrently with a close, or
+//	              after it in the same process, i.e. unless the send
+//	              precedes the close in the same function
+//
+// Only the Ops of the violations are set.
+func StaticSafety(prog *migo.Program, opts Options) (*SafetyResult, error) {
+	a, err := newStatic(prog, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	type use struct {
+		op    Op
+		order int // position in the walk of the function
+	}
+	closes := make(map[interface{}][]use)
+	sends := make(map[interface{}][]use)
+	var order []interface{}
+	for _, fn := range prog.Funcs {
+		if len(a.rootsOf[fn]) == 0 {
+			continue // unreachable
+		}
+		i := 0
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			i++
+			var uses map[interface{}][]use
+			var name string
+			switch stmt := stmt.(type) {
+			case *migo.CloseStatement:
+				uses, name = closes, stmt.Chan
+			case *migo.SendStatement:
+				uses, name = sends, stmt.Chan
+			default:
+				return
+			}
+			for _, ch := range a.sites(fn, name) {
+				if closes[ch] == nil && sends[ch] == nil {
+					order = append(order, ch)
+				}
+				uses[ch] = append(uses[ch], use{op: Op{Func: fn, Stmt: stmt}, order: i})
+			}
+		})
+	}
+
+	res := &SafetyResult{}
+	for _, ch := range order {
+		cs := closes[ch]
+		if len(cs) == 0 {
+			continue
+		}
+		name := siteName(ch)
+		var procs []*migo.Function // roots of the closes
+		many := false              // whether a close may run more than once
+		for _, c := range cs {
+			for _, r := range a.rootsOf[c.op.Func] {
+				procs = appendFunc(procs, r)
+				many = many || a.multi[r]
+			}
+			many = many || a.repeated[c.op.Func]
+		}
+		if len(cs) > 1 || many {
+			v := &SafetyViolation{Kind: DoubleClose, Chan: name}
+			for _, c := range cs {
+				v.Ops = append(v.Ops, c.op)
+			}
+			res.Violations = append(res.Violations, v)
+		}
+		if len(procs) > 1 || (len(procs) == 1 && a.multi[procs[0]]) {
+			v := &SafetyViolation{Kind: MultiClose, Chan: name}
+			for _, c := range cs {
+				v.Ops = append(v.Ops, c.op)
+			}
+			res.Violations = append(res.Violations, v)
+		}
+		for _, s := range sends[ch] {
+			unsafe := false
+			for _, c := range cs {
+				if a.mayFollow(s.op.Func, s.order, c.op.Func, c.order) {
+					unsafe = true
+				}
+			}
+			if unsafe {
+				res.Violations = append(res.Violations, &SafetyViolation{Kind: SendOnClosed, Chan: name, Ops: []Op{s.op}})
+			}
+		}
+	}
+	return res, nil
+}
+
+// static is the call graph based approximation of the processes and
+// resources of a program.
+//
+// A resource (site) is identified by its declaration (let, letmem or letsync
+// statement), or by its name if global.
+type static struct {
+	prog     *migo.Program
+	names    map[*migo.Function]map[string]map[interface{}]bool // resources of names in each function
+	roots    []*migo.Function                                   // roots of processes, entry first
+	rootsOf  map[*migo.Function][]*migo.Function                // roots of processes running each function
+	multi    map[*migo.Function]bool                            // roots which may run in more than one process
+	repeated map[*migo.Function]bool                            // functions which may run more than once in a process
+}
+
+func newStatic(prog *migo.Program, opts Options) (*static, error) {
+	entry, ok := prog.Function(opts.entry())
+	if !ok {
+		return nil, &semantics.ErrNoEntry{Entry: opts.entry()}
+	}
+	a := &static{prog: prog, names: make(map[*migo.Function]map[string]map[interface{}]bool)}
+	a.resources(entry)
+	a.callGraph(entry)
+	return a, nil
+}
+
+// siteName returns the name of resource site, i.e. a declaration or name.
+func siteName(site interface{}) string {
+	if name, ok := site.(string); ok {
+		return name
+	}
+	return subst.Declared(site.(migo.Statement))
+}
+
+// sites returns the resources of name in fn.
+func (a *static) sites(fn *migo.Function, name string) []interface{} {
+	var chans []interface{}
+	for ch := range a.names[fn][name] {
+		chans = append(chans, ch)
+	}
+	// Deterministic order: declarations in program order, then globals.
+	var ordered []interface{}
+	for _, f := range a.prog.Funcs {
+		subst.Walk(f.Stmts, func(stmt migo.Statement) {
+			if subst.Declared(stmt) != "" && a.names[fn][name][stmt] {
+				ordered = append(ordered, stmt)
+			}
+		})
+	}
+	var globals []string
+	for _, ch := range chans {
+		if global, ok := ch.(string); ok {
+			globals = append(globals, global)
+		}
+	}
+	sort.Strings(globals)
+	for _, global := range globals {
+		ordered = append(ordered, global)
+	}
+	return ordered
+}
+
+// resources computes the resources of the names in each function,
+// where the parameters of entry are globals.
+func (a *static) resources(entry *migo.Function) {
+	add := func(fn *migo.Function, name string, ch interface{}) bool {
+		if a.names[fn][name] == nil {
+			a.names[fn][name] = make(map[interface{}]bool)
+		}
+		if a.names[fn][name][ch] {
+			return false
+		}
+		a.names[fn][name][ch] = true
+		return true
+	}
+	for _, fn := range a.prog.Funcs {
+		a.names[fn] = make(map[string]map[interface{}]bool)
+		bound := make(map[string]bool)
+		for _, p := range fn.Params {
+			bound[p.Callee.Name()] = fn != entry
+		}
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if name := subst.Declared(stmt); name != "" {
+				add(fn, name, stmt)
+				bound[name] = true
+			}
+		})
+		for name := range subst.Free(fn.Stmts) {
+			if !bound[name] {
+				add(fn, name, name) // global
+			}
+		}
+	}
+	pass := func(caller *migo.Function, name string, params []*migo.Parameter) bool {
+		callee, ok := a.prog.Function(name)
+		if !ok || len(callee.Params) != len(params) {
+			return false
+		}
+		changed := false
+		for i, p := range params {
+			for ch := range a.names[caller][p.Caller.Name()] {
+				changed = add(callee, callee.Params[i].Callee.Name(), ch) || changed
+			}
+		}
+		return changed
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range a.prog.Funcs {
+			subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+				switch stmt := stmt.(type) {
+				case *migo.CallStatement:
+					changed = pass(fn, stmt.Name, stmt.Params) || changed
+				case *migo.SpawnStatement:
+					changed = pass(fn, stmt.Name, stmt.Params) || changed
+				}
+			})
+		}
+	}
+}
+
+// callGraph computes the roots of the processes from entry, the roots which
+// may run in more than one process, and the functions which may run more
+// than once in a process, i.e. reachable by calls from a cycle of calls or
+// from a function called at more than one call site in a process.
+func (a *static) callGraph(entry *migo.Function) {
+	calls := make(map[*migo.Function][]*migo.Function)
+	spawns := make(map[*migo.Function][]*migo.Function)
+	for _, fn := range a.prog.Funcs {
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			switch stmt := stmt.(type) {
+			case *migo.CallStatement:
+				if callee, ok := a.prog.Function(stmt.Name); ok {
+					calls[fn] = append(calls[fn], callee)
+				}
+			case *migo.SpawnStatement:
+				if callee, ok := a.prog.Function(stmt.Name); ok {
+					spawns[fn] = append(spawns[fn], callee)
+				}
+			}
+		})
+	}
+	reach := func(root *migo.Function) []*migo.Function {
+		visited := map[*migo.Function]bool{root: true}
+		fns := []*migo.Function{root}
+		for i := 0; i < len(fns); i++ {
+			for _, callee := range calls[fns[i]] {
+				if !visited[callee] {
+					visited[callee] = true
+					fns = append(fns, callee)
+				}
+			}
+		}
+		return fns
+	}
+	a.repeated = make(map[*migo.Function]bool)
+	for _, fn := range a.prog.Funcs {
+		for _, callee := range calls[fn] {
+			for _, f := range reach(callee) {
+				if f == fn {
+					for _, g := range reach(fn) {
+						a.repeated[g] = true
+					}
+				}
+			}
+		}
+	}
+
+	a.rootsOf = make(map[*migo.Function][]*migo.Function)
+	a.multi = make(map[*migo.Function]bool)
+	roots := []*migo.Function{entry}
+	visited := map[*migo.Function]bool{entry: true}
+	for i := 0; i < len(roots); i++ {
+		for _, fn := range reach(roots[i]) {
+			a.rootsOf[fn] = appendFunc(a.rootsOf[fn], roots[i])
+			for _, child := range spawns[fn] {
+				if !visited[child] {
+					visited[child] = true
+					roots = append(roots, child)
+				}
+			}
+		}
+	}
+	a.roots = roots
+	for _, r := range roots {
+		sites := map[*migo.Function]int{r: 1} // number of call sites in the process
+		for _, fn := range reach(r) {
+			for _, callee := range calls[fn] {
+				sites[callee]++
+			}
+		}
+		for fn, n := range sites {
+			if n > 1 {
+				for _, g := range reach(fn) {
+					a.repeated[g] = true
+				}
+			}
+		}
+	}
+	spawned := make(map[*migo.Function]int) // number of spawns of each root
+	for _, r := range roots {
+		for _, fn := range reach(r) {
+			for _, child := range spawns[fn] {
+				spawned[child]++
+				if a.repeated[fn] {
+					spawned[child]++
+				}
+			}
+		}
+	}
+	for _, r := range roots {
+		a.multi[r] = spawned[r] > 1
+	}
+	// A root spawned by a root which may run more than once.
+	for changed := true; changed; {
+		changed = false
+		for _, r := range roots {
+			if !a.multi[r] {
+				continue
+			}
+			for _, fn := range reach(r) {
+				for _, child := range spawns[fn] {
+					if !a.multi[child] {
+						a.multi[child] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// mayFollow returns true if the send at position i of function send may
+// run after (or concurrently with) the close at position j of function
+// close.
+func (a *static) mayFollow(send *migo.Function, i int, close *migo.Function, j int) bool {
+	for _, r := range a.rootsOf[send] {
+		for _, q := range a.rootsOf[close] {
+			if r != q || a.multi[r] {
+				return true // different processes
+			}
+		}
+	}
+	return send != close || a.repeated[send] || j < i
+}
+
+func appendFunc(fns []*migo.Function, fn *migo.Function) []*migo.Function {
+	for _, f := range fns {
+		if f == fn {
+			return fns
+		}
+	}
+	return append(fns, fn)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nickng/migo/v3/check"
+	"github.com/nickng/migo/v3/parser"
+	"github.com/nickng/migo/v3/sim"
+)
+
+const debugHelp = `commands:
+  step [n]     (s)  take the next n steps of the execution
+  continue     (c)  take steps until a breakpoint or the end of the execution
+  enabled      (e)  list the enabled transitions
+  take i       (t)  take the i-th enabled transition
+  break [name] (b)  set a breakpoint on a function or channel, or list them
+  clear name        remove a breakpoint
+  print        (p)  show the goroutines, channels and locks
+  trace             show the steps taken
+  restart      (r)  return to the initial configuration
+  help         (h)  show this help
+  quit         (q)  exit
+An empty line repeats the last command.
+`
+
+// debug runs the debug command with arguments args.
+func debug(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	fs.SetOutput(out)
+	entry := fs.String("entry", "main", "entry function")
+	tracePath := fs.String("trace", "", "replay the trace in JSON `file`")
+	deadlock := fs.Bool("deadlock", false, "replay the first deadlock found")
+	seed := fs.Int64("seed", 0, "replay a random execution with seed `n`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: migo debug [-entry main] [-trace trace.json | -deadlock | -seed n] file.migo")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	prog, err := parser.Parse(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	d, err := sim.NewDebugger(prog, *entry)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *tracePath != "":
+		b, err := os.ReadFile(*tracePath)
+		if err != nil {
+			return err
+		}
+		var tr sim.Trace
+		if err := json.Unmarshal(b, &tr); err != nil {
+			return err
+		}
+		if err := d.LoadTrace(&tr); err != nil {
+			return err
+		}
+	case *deadlock:
+		res, err := check.Deadlocks(prog, check.Options{Entry: *entry})
+		if err != nil {
+			return err
+		}
+		if len(res.Deadlocks) == 0 {
+			return fmt.Errorf("no deadlock found in %d states", res.States)
+		}
+		fmt.Fprint(out, res.Deadlocks[0].String())
+		d.LoadLabels(res.Deadlocks[0].Trace)
+	default:
+		tr, err := sim.Run(prog, sim.Options{Entry: *entry, Seed: *seed})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "random execution with seed %d: %s\n", *seed, tr.Outcome)
+		if err := d.LoadTrace(tr); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "%d steps to replay\n", d.Remaining())
+	repl(d, in, out)
+	return nil
+}
+
+// repl reads and runs debugger commands from in until quit or the end of in.
+func repl(d *sim.Debugger, in io.Reader, out io.Writer) {
+	printSteps := func(steps []sim.Step) { // the last steps taken
+		first := len(d.Steps()) - len(steps)
+		for i, s := range steps {
+			fmt.Fprintf(out, "  %d. %s (%s)\n", first+i+1, s.Label, strings.Join(s.Stmts, ", "))
+		}
+	}
+	sc := bufio.NewScanner(in)
+	var last []string
+	for {
+		fmt.Fprint(out, "(migo) ")
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		cmd := strings.Fields(sc.Text())
+		if len(cmd) == 0 {
+			cmd = last
+		}
+		last = cmd
+		if len(cmd) == 0 {
+			continue
+		}
+		switch cmd[0] {
+		case "step", "s":
+			n := 1
+			if len(cmd) > 1 {
+				var err error
+				if n, err = strconv.Atoi(cmd[1]); err != nil {
+					fmt.Fprintln(out, "invalid number of steps:", cmd[1])
+					continue
+				}
+			}
+			for i := 0; i < n; i++ {
+				s, err := d.Step()
+				if err != nil {
+					fmt.Fprintln(out, err)
+					break
+				}
+				printSteps([]sim.Step{s})
+			}
+		case "continue", "c":
+			steps, err := d.Continue()
+			printSteps(steps)
+			if err != nil {
+				fmt.Fprintln(out, err)
+			} else {
+				fmt.Fprintln(out, "breakpoint")
+			}
+		case "enabled", "e":
+			for i, t := range d.Enabled() {
+				fmt.Fprintf(out, "  [%d] %s\n", i, t.Label.String())
+			}
+		case "take", "t":
+			if len(cmd) < 2 {
+				fmt.Fprintln(out, "usage: take i")
+				continue
+			}
+			i, err := strconv.Atoi(cmd[1])
+			if err != nil {
+				fmt.Fprintln(out, "invalid transition:", cmd[1])
+				continue
+			}
+			s, err := d.Take(i)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			printSteps([]sim.Step{s})
+		case "break", "b":
+			if len(cmd) < 2 {
+				fmt.Fprintln(out, strings.Join(d.Breakpoints(), " "))
+				continue
+			}
+			for _, name := range cmd[1:] {
+				d.Break(name)
+			}
+		case "clear":
+			for _, name := range cmd[1:] {
+				d.Clear(name)
+			}
+		case "print", "p":
+			fmt.Fprint(out, d)
+		case "trace":
+			printSteps(d.Steps())
+		case "restart", "r":
+			d.Restart()
+		case "help", "h":
+			fmt.Fprint(out, debugHelp)
+		case "quit", "q":
+			return
+		default:
+			fmt.Fprintf(out, "unknown command %s (type help for the commands)\n", cmd[0])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prog.migo")
+	prog := `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch; recv ch;
+def s(c): send c;`
+	if err := os.WriteFile(file, []byte(prog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	in := strings.NewReader("break s\nc\n\np\nq\n")
+	if err := debug([]string{"-deadlock", file}, in, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `deadlock: 0@main: recv ch
+  1. newchan [0@main: let ch = newchan ch, 0]
+  2. spawn [0@main: spawn s(ch)]
+  3. sync [1@s: send c | 0@main: recv ch]
+3 steps to replay
+(migo) (migo)   1. newchan [0@main: let ch = newchan ch, 0] (main:1)
+  2. spawn [0@main: spawn s(ch)] (main:2)
+breakpoint
+(migo)   3. sync [1@s: send c | 0@main: recv ch] (s:1, main:3)
+breakpoint
+(migo) blocked
+  0@main: recv ch (main:4)
+  chan ch#0: 0/0
+(migo) `
+	if got := out.String(); want != got {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
@@ -0,0 +1,41 @@
+// Command migo is a tool for MiGo types.
+//
+// Usage:
+//
+//	migo debug [-entry main] [-trace trace.json | -deadlock | -seed n] file.migo
+//
+// The debug command replays an execution of the program in file.migo in an
+// interactive debugger: a trace exported as JSON by package sim, the first
+// deadlock found by package check, or a random execution (the default).
+// Type help in the debugger for the list of commands.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: migo <command> [arguments]
+
+commands:
+  debug    replay an execution of a program step by step
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "debug":
+		err = debug(os.Args[2:], os.Stdin, os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migo:", err)
+		os.Exit(1)
+	}
+}
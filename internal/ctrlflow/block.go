@@ -0,0 +1,272 @@
+package ctrlflow
+
+// This file contains the intra-procedural (statement-level) control-flow
+// graph of a single MiGo function.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// BlockKind is the kind of a Block in a FuncGraph.
+type BlockKind int
+
+const (
+	EntryBlock  BlockKind = iota // Unique entry of a function.
+	ExitBlock                    // Unique exit of a function.
+	PlainBlock                   // Straight-line statements.
+	BranchBlock                  // Conditional (if or ifFor) branching.
+	SelectBlock                  // Non-deterministic choice (select).
+	JoinBlock                    // Join point of a branch or select.
+	CallBlock                    // Function call.
+	SpawnBlock                   // Goroutine spawn.
+)
+
+func (k BlockKind) String() string {
+	switch k {
+	case EntryBlock:
+		return "entry"
+	case ExitBlock:
+		return "exit"
+	case PlainBlock:
+		return "plain"
+	case BranchBlock:
+		return "branch"
+	case SelectBlock:
+		return "select"
+	case JoinBlock:
+		return "join"
+	case CallBlock:
+		return "call"
+	case SpawnBlock:
+		return "spawn"
+	}
+	return fmt.Sprintf("BlockKind(%d)", int(k))
+}
+
+// Block is a basic block of a FuncGraph.
+//
+// A PlainBlock holds a sequence of straight-line statements. BranchBlock,
+// SelectBlock, CallBlock and SpawnBlock hold exactly one statement, the
+// statement they represent. EntryBlock, ExitBlock and JoinBlock are empty.
+//
+// The successors of a BranchBlock are ordered Then then Else, and the
+// successors of a SelectBlock are ordered as the cases of the select, where
+// each case block starts with the prefix (guard) of the case.
+type Block struct {
+	Index int              // Index of the block in FuncGraph.Blocks.
+	Kind  BlockKind        // Kind of the block.
+	Stmts []migo.Statement // Statements of the block.
+	Preds []*Block
+	Succs []*Block
+}
+
+func (b *Block) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("b%d (%s):\n", b.Index, b.Kind))
+	if len(b.Stmts) > 0 {
+		for _, line := range strings.Split(blockLabel(b), "\n") {
+			sb.WriteString(fmt.Sprintf("\t%s\n", line))
+		}
+	}
+	if len(b.Preds) > 0 {
+		sb.WriteString(fmt.Sprintf("\tFROM → %s\n", blockNames(b.Preds)))
+	}
+	if len(b.Succs) > 0 {
+		sb.WriteString(fmt.Sprintf("\tTO   ⇒ %s\n", blockNames(b.Succs)))
+	}
+	return sb.String()
+}
+
+func blockNames(blocks []*Block) string {
+	names := make([]string, len(blocks))
+	for i, b := range blocks {
+		names[i] = fmt.Sprintf("b%d", b.Index)
+	}
+	return strings.Join(names, ", ")
+}
+
+// FuncGraph is the control-flow graph of the body of a MiGo function.
+type FuncGraph struct {
+	Func   *migo.Function
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block // All blocks, Entry first and Exit last.
+}
+
+// NewFuncGraph returns a new statement-level CFG of function fn.
+//
+// A migo.CustomStatement with children is represented as a BranchBlock
+// with a branch for each child, and a migo.CustomStatement without children
+// as a statement of a PlainBlock. Any other statement not defined in the
+// migo package is rejected with an *migo.ErrUnknownStatement.
+func NewFuncGraph(fn *migo.Function) (*FuncGraph, error) {
+	g := &FuncGraph{Func: fn}
+	g.Entry = g.newBlock(EntryBlock)
+	last, err := g.build(g.Entry, fn.Stmts)
+	if err != nil {
+		return nil, err
+	}
+	g.Exit = g.newBlock(ExitBlock)
+	g.addEdge(last, g.Exit)
+	return g, nil
+}
+
+func (g *FuncGraph) newBlock(kind BlockKind, stmts ...migo.Statement) *Block {
+	b := &Block{Index: len(g.Blocks), Kind: kind, Stmts: stmts}
+	g.Blocks = append(g.Blocks, b)
+	return b
+}
+
+// addEdge creates an edge from Block b1 to Block b2.
+func (g *FuncGraph) addEdge(b1, b2 *Block) {
+	b1.Succs = append(b1.Succs, b2)
+	b2.Preds = append(b2.Preds, b1)
+}
+
+// build adds stmts to the graph after Block cur,
+// and returns the last Block of stmts.
+func (g *FuncGraph) build(cur *Block, stmts []migo.Statement) (*Block, error) {
+	var err error
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			cur, err = g.buildBranch(cur, stmt, stmt.Then, stmt.Else)
+		case *migo.IfForStatement:
+			cur, err = g.buildBranch(cur, stmt, stmt.Then, stmt.Else)
+		case *migo.SelectStatement:
+			cur, err = g.buildBranch(cur, stmt, stmt.Cases...)
+		case *migo.CallStatement:
+			b := g.newBlock(CallBlock, stmt)
+			g.addEdge(cur, b)
+			cur = b
+		case *migo.SpawnStatement:
+			b := g.newBlock(SpawnBlock, stmt)
+			g.addEdge(cur, b)
+			cur = b
+		case *migo.NewChanStatement, *migo.CloseStatement, *migo.SendStatement, *migo.RecvStatement, *migo.TauStatement,
+			*migo.NewMem, *migo.MemRead, *migo.MemWrite,
+			*migo.NewSyncMutex, *migo.SyncMutexLock, *migo.SyncMutexUnlock,
+			*migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock,
+			*migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
+			cur = g.appendPlain(cur, stmt)
+		case migo.CustomStatement:
+			if children := stmt.Children(); len(children) > 0 {
+				cur, err = g.buildBranch(cur, stmt, children...)
+			} else {
+				cur = g.appendPlain(cur, stmt)
+			}
+		default:
+			return nil, &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cur, nil
+}
+
+// appendPlain appends straight-line statement stmt after Block cur,
+// and returns the PlainBlock stmt is in.
+func (g *FuncGraph) appendPlain(cur *Block, stmt migo.Statement) *Block {
+	if cur.Kind != PlainBlock {
+		b := g.newBlock(PlainBlock)
+		g.addEdge(cur, b)
+		cur = b
+	}
+	cur.Stmts = append(cur.Stmts, stmt)
+	return cur
+}
+
+// buildBranch adds a branching statement stmt with bodies as its branches
+// after Block cur, and returns the join Block of the branches.
+func (g *FuncGraph) buildBranch(cur *Block, stmt migo.Statement, bodies ...[]migo.Statement) (*Block, error) {
+	kind := BranchBlock
+	if _, isSelect := stmt.(*migo.SelectStatement); isSelect {
+		kind = SelectBlock
+	}
+	br := g.newBlock(kind, stmt)
+	g.addEdge(cur, br)
+	join := g.newBlock(JoinBlock)
+	for _, body := range bodies {
+		b := g.newBlock(PlainBlock)
+		g.addEdge(br, b)
+		last, err := g.build(b, body)
+		if err != nil {
+			return nil, err
+		}
+		g.addEdge(last, join)
+	}
+	return join, nil
+}
+
+func (g *FuncGraph) String() string {
+	var sb strings.Builder
+	for _, b := range g.Blocks {
+		sb.WriteString(b.String())
+	}
+	return sb.String()
+}
+
+// DotString returns a string representation the graph in dot format.
+func (g *FuncGraph) DotString() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("digraph %q {\n", g.Func.Name))
+	for _, b := range g.Blocks {
+		sb.WriteString(fmt.Sprintf("b%d [shape=%s,label=%q];\n", b.Index, blockShape(b.Kind), blockLabel(b)))
+	}
+	for _, b := range g.Blocks {
+		for i, s := range b.Succs {
+			switch b.Kind {
+			case BranchBlock:
+				label := fmt.Sprintf("branch %d", i)
+				if len(b.Succs) == 2 {
+					label = [2]string{"then", "else"}[i]
+				}
+				sb.WriteString(fmt.Sprintf("b%d -> b%d [label=%q];\n", b.Index, s.Index, label))
+			case SelectBlock:
+				sb.WriteString(fmt.Sprintf("b%d -> b%d [label=\"case %d\"];\n", b.Index, s.Index, i))
+			default:
+				sb.WriteString(fmt.Sprintf("b%d -> b%d;\n", b.Index, s.Index))
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func blockShape(kind BlockKind) string {
+	switch kind {
+	case EntryBlock, ExitBlock:
+		return "oval"
+	case BranchBlock, SelectBlock:
+		return "diamond"
+	case JoinBlock:
+		return "circle"
+	}
+	return "box"
+}
+
+func blockLabel(b *Block) string {
+	switch b.Kind {
+	case EntryBlock, ExitBlock, JoinBlock:
+		return b.Kind.String()
+	case BranchBlock:
+		switch stmt := b.Stmts[0].(type) {
+		case *migo.IfStatement:
+			return "if"
+		case *migo.IfForStatement:
+			return fmt.Sprintf("ifFor %s", stmt.ForCond)
+		}
+		return b.Stmts[0].String()
+	case SelectBlock:
+		return "select"
+	}
+	lines := make([]string, len(b.Stmts))
+	for i, stmt := range b.Stmts {
+		lines[i] = stmt.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,112 @@
+package ctrlflow_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/internal/ctrlflow"
+	"github.com/nickng/migo/v3/parser"
+)
+
+func TestFuncGraphStraightLine(t *testing.T) {
+	s := `def main(): send a; recv b; tau;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewFuncGraph(prog.Funcs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Order: entry, plain, exit
+	if want, got := 3, len(g.Blocks); want != got {
+		t.Fatalf("expected %d blocks but got %d:\n%s", want, got, g)
+	}
+	if want, got := 3, len(g.Blocks[1].Stmts); want != got {
+		t.Errorf("expected %d statements in block but got %d:\n%s", want, got, g)
+	}
+	if g.Entry.Succs[0] != g.Blocks[1] || g.Blocks[1].Succs[0] != g.Exit {
+		t.Errorf("expected entry → b1 → exit but got:\n%s", g)
+	}
+}
+
+func TestFuncGraphBranch(t *testing.T) {
+	s := `
+def main():
+	send a;
+	if send b; call f(); else recv c; endif;
+	select
+	case recv a; spawn g();
+	case send b;
+	case tau;
+	endselect;
+	close a;
+def f(): tau;
+def g(): tau;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewFuncGraph(prog.Funcs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Order:
+	//   entry, plain(send a),
+	//   branch, join, plain(send b), call f, plain(recv c),
+	//   select, join, plain(recv a), spawn g, plain(send b), plain(tau),
+	//   plain(close a), exit
+	kinds := []ctrlflow.BlockKind{
+		ctrlflow.EntryBlock, ctrlflow.PlainBlock,
+		ctrlflow.BranchBlock, ctrlflow.JoinBlock, ctrlflow.PlainBlock, ctrlflow.CallBlock, ctrlflow.PlainBlock,
+		ctrlflow.SelectBlock, ctrlflow.JoinBlock, ctrlflow.PlainBlock, ctrlflow.SpawnBlock, ctrlflow.PlainBlock, ctrlflow.PlainBlock,
+		ctrlflow.PlainBlock, ctrlflow.ExitBlock,
+	}
+	if want, got := len(kinds), len(g.Blocks); want != got {
+		t.Fatalf("expected %d blocks but got %d:\n%s", want, got, g)
+	}
+	for i, kind := range kinds {
+		if want, got := kind, g.Blocks[i].Kind; want != got {
+			t.Errorf("block[%d]: expected %s block but got %s", i, want, got)
+		}
+	}
+	preds := []int{0, 1, 1, 2, 1, 1, 1, 1, 3, 1, 1, 1, 1, 1, 1}
+	succs := []int{1, 1, 2, 1, 1, 1, 1, 3, 1, 1, 1, 1, 1, 1, 0}
+	for i := range g.Blocks {
+		if want, got := succs[i], len(g.Blocks[i].Succs); want != got {
+			t.Errorf("block[%d]: expected %d successors but got %d: %v", i, want, got, g.Blocks[i])
+		}
+		if want, got := preds[i], len(g.Blocks[i].Preds); want != got {
+			t.Errorf("block[%d]: expected %d predecessors but got %d: %v", i, want, got, g.Blocks[i])
+		}
+	}
+	if want, got := g.Blocks[4], g.Blocks[2].Succs[0]; want != got {
+		t.Errorf("expected then-branch to be b%d but got b%d", want.Index, got.Index)
+	}
+	if edge := `b7 -> b12 [label="case 2"];`; !strings.Contains(g.DotString(), edge) {
+		t.Errorf("expected select edge `%s` in dot output:\n%s", edge, g.DotString())
+	}
+}
+
+func TestFuncGraphEmptySelect(t *testing.T) {
+	s := `def main(): select endselect; send a;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewFuncGraph(prog.Funcs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Order: entry, select, join, plain(send a), exit
+	if want, got := 5, len(g.Blocks); want != got {
+		t.Fatalf("expected %d blocks but got %d:\n%s", want, got, g)
+	}
+	if want, got := 0, len(g.Blocks[2].Preds); want != got {
+		t.Errorf("expected join of empty select to be unreachable but got %d predecessors", got)
+	}
+}
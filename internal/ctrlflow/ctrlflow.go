@@ -1,10 +1,12 @@
 // Package ctrlflow represents and constructs control-flow graph (CFG)
 // of MiGo functions in a MiGo program.
+//
+// Graph is the function-level (call) graph of a program, and
+// FuncGraph is the statement-level graph of the body of a function.
 package ctrlflow
 
 import (
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/nickng/migo/v3"
@@ -14,15 +16,24 @@ import (
 type Graph struct {
 	Nodes []*Node
 
-	prog *migo.Program
+	prog  *migo.Program
+	nodes map[*migo.Function]*Node
+	edges map[*Node]map[*Node]EdgeKind
 }
 
 func (g *Graph) addNode(n *Node) {
 	g.Nodes = append(g.Nodes, n)
 }
 
-// addEdge creates an edge from Node n1 to Node n2.
-func (g *Graph) addEdge(n1, n2 *Node) {
+// addEdge creates an edge of kind kind from Node n1 to Node n2.
+func (g *Graph) addEdge(n1, n2 *Node, kind EdgeKind) {
+	if g.edges == nil {
+		g.edges = make(map[*Node]map[*Node]EdgeKind)
+	}
+	if g.edges[n1] == nil {
+		g.edges[n1] = make(map[*Node]EdgeKind)
+	}
+	g.edges[n1][n2] |= kind
 	childExists := false
 	for _, c := range n1.Succs {
 		if c == n2 {
@@ -54,27 +65,28 @@ func (g *Graph) String() string {
 }
 
 // DotString returns a string representation the graph in dot format.
+//
+// Spawn edges are dashed.
 func (g *Graph) DotString() string {
-	name := make(map[*Node]string)
+	id := g.NodeIDs()
 	printed := make(map[*Node]map[*Node]bool)
 	for _, n := range g.Nodes {
-		name[n] = strings.Replace(n.fn.SimpleName(), ".", "_", -1)
 		printed[n] = make(map[*Node]bool)
 	}
 
 	var sb strings.Builder
 	sb.WriteString("digraph G {\n")
 	for _, n := range g.Nodes {
-		sb.WriteString(fmt.Sprintf("%s [label=\"%s\"];\n", name[n], n.fn.Name))
+		sb.WriteString(fmt.Sprintf("%s [label=%q];\n", id[n], n.fn.Name))
 		for _, p := range n.Preds {
 			if _, ok := printed[p][n]; !ok {
-				sb.WriteString(fmt.Sprintf("%s -> %s;\n", name[p], name[n]))
+				sb.WriteString(fmt.Sprintf("%s -> %s%s;\n", id[p], id[n], dotEdgeAttrs(g.EdgeKind(p, n))))
 				printed[p][n] = true
 			}
 		}
 		for _, s := range n.Succs {
 			if _, ok := printed[n][s]; !ok {
-				sb.WriteString(fmt.Sprintf("%s -> %s;\n", name[n], name[s]))
+				sb.WriteString(fmt.Sprintf("%s -> %s%s;\n", id[n], id[s], dotEdgeAttrs(g.EdgeKind(n, s))))
 				printed[n][s] = true
 			}
 		}
@@ -83,6 +95,13 @@ func (g *Graph) DotString() string {
 	return sb.String()
 }
 
+func dotEdgeAttrs(kind EdgeKind) string {
+	if kind&SpawnEdge != 0 {
+		return fmt.Sprintf(" [style=dashed,label=%q]", kind)
+	}
+	return ""
+}
+
 // Node is a CFG node (function) for a migo program.
 type Node struct {
 	Preds []*Node
@@ -118,15 +137,22 @@ func (n *Node) String() string {
 }
 
 // NewGraph returns a new CFG given MiGo program prog.
-func NewGraph(prog *migo.Program) *Graph {
+//
+// Statements not defined in the migo package are traversed with the
+// migo.CustomStatement interface, otherwise an
+// *migo.ErrUnknownStatement is returned.
+func NewGraph(prog *migo.Program) (*Graph, error) {
 	b := builder{
 		graph:   &Graph{prog: prog},
 		visited: make(map[*migo.Function]bool),
 	}
 	for _, f := range b.graph.prog.Funcs {
-		b.visit(f)
+		if err := b.visit(f); err != nil {
+			return nil, err
+		}
 	}
-	return b.graph
+	b.graph.nodes = b.nodes
+	return b.graph, nil
 }
 
 // builder is a data structure to build a CFG.
@@ -138,10 +164,10 @@ type builder struct {
 	visited map[*migo.Function]bool
 }
 
-func (b *builder) visit(fn *migo.Function) {
+func (b *builder) visit(fn *migo.Function) error {
 	if completed, started := b.visited[fn]; started { // key exists, visit started
 		_ = completed
-		return
+		return nil
 	}
 	b.visited[fn] = false // visit started
 	if b.nodes == nil {
@@ -150,11 +176,14 @@ func (b *builder) visit(fn *migo.Function) {
 	n := &Node{fn: fn}
 	b.nodes[fn] = n
 	b.graph.addNode(n)
-	b.visitStmts(fn, fn.Stmts) // visit body
-	b.visited[fn] = true       // visit complete
+	if err := b.visitStmts(fn, fn.Stmts); err != nil { // visit body
+		return err
+	}
+	b.visited[fn] = true // visit complete
+	return nil
 }
 
-func (b *builder) visitStmts(parent *migo.Function, stmts []migo.Statement) {
+func (b *builder) visitStmts(parent *migo.Function, stmts []migo.Statement) error {
 	for _, stmt := range stmts {
 		switch stmt := stmt.(type) {
 		case *migo.NewChanStatement, *migo.CloseStatement:
@@ -167,28 +196,34 @@ func (b *builder) visitStmts(parent *migo.Function, stmts []migo.Statement) {
 			// no-op
 
 		case *migo.SelectStatement:
-			for _, stmts := range stmt.Cases {
-				b.visitStmts(parent, stmts)
+			if err := b.visitBlocks(parent, stmt.Cases...); err != nil {
+				return err
 			}
 
 		case *migo.IfStatement:
-			b.visitStmts(parent, stmt.Then)
-			b.visitStmts(parent, stmt.Else)
+			if err := b.visitBlocks(parent, stmt.Then, stmt.Else); err != nil {
+				return err
+			}
 
 		case *migo.IfForStatement:
-			b.visitStmts(parent, stmt.Then)
-			b.visitStmts(parent, stmt.Else)
+			if err := b.visitBlocks(parent, stmt.Then, stmt.Else); err != nil {
+				return err
+			}
 
 		case *migo.CallStatement:
 			if fn, found := b.graph.prog.Function(stmt.Name); found {
-				b.visit(fn)
-				b.graph.addEdge(b.nodes[parent], b.nodes[fn])
+				if err := b.visit(fn); err != nil {
+					return err
+				}
+				b.graph.addEdge(b.nodes[parent], b.nodes[fn], CallEdge)
 			}
 
 		case *migo.SpawnStatement:
 			if fn, found := b.graph.prog.Function(stmt.Name); found {
-				b.visit(fn)
-				b.graph.addEdge(b.nodes[parent], b.nodes[fn])
+				if err := b.visit(fn); err != nil {
+					return err
+				}
+				b.graph.addEdge(b.nodes[parent], b.nodes[fn], SpawnEdge)
 			}
 
 		case *migo.NewMem, *migo.MemRead, *migo.MemWrite:
@@ -197,11 +232,27 @@ func (b *builder) visitStmts(parent *migo.Function, stmts []migo.Statement) {
 		case *migo.NewSyncMutex, *migo.SyncMutexLock, *migo.SyncMutexUnlock:
 			// no-op
 
-		case *migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock:
+		case *migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock,
+			*migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
 			// no-op
 
+		case migo.CustomStatement:
+			if err := b.visitBlocks(parent, stmt.Children()...); err != nil {
+				return err
+			}
+
 		default:
-			log.Fatal(fmt.Errorf("ctrlflow: statement kind not found: %T", stmt))
+			return &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+	}
+	return nil
+}
+
+func (b *builder) visitBlocks(parent *migo.Function, blocks ...[]migo.Statement) error {
+	for _, stmts := range blocks {
+		if err := b.visitStmts(parent, stmts); err != nil {
+			return err
 		}
 	}
+	return nil
 }
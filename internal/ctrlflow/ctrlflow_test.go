@@ -15,7 +15,10 @@ func TestEmpty(t *testing.T) {
 		t.Error(err)
 		t.FailNow()
 	}
-	g := ctrlflow.NewGraph(prog)
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if want, got := 1, len(g.Nodes); want != got {
 		t.Errorf("expected %d node but got %d", want, got)
 	}
@@ -41,7 +44,10 @@ def e(): tau;
 		t.Error(err)
 		t.FailNow()
 	}
-	g := ctrlflow.NewGraph(prog)
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if want, got := 6, len(g.Nodes); want != got {
 		t.Errorf("expected %d nodes but got %d", want, got)
 	}
@@ -89,7 +95,10 @@ def h():
 		t.Error(err)
 		t.FailNow()
 	}
-	g := ctrlflow.NewGraph(prog)
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
 	// Order:
 	//   main       .
 	//   sel           .
@@ -134,7 +143,10 @@ def mutual_recursive_b():
 		t.Error(err)
 		t.FailNow()
 	}
-	g := ctrlflow.NewGraph(prog)
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if want, got := 7, len(g.Nodes); want != got {
 		t.Errorf("expected %d node but got %d", want, got)
 	}
@@ -0,0 +1,214 @@
+package ctrlflow
+
+// This file contains exporters of the function-level Graph
+// to visualisation and interchange formats.
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// NodeIDs returns a stable identifier for each Node in the graph.
+//
+// Identifiers are derived from the function names with characters other
+// than [A-Za-z0-9_] replaced by _, and are unique within the graph: if two
+// functions map to the same identifier, the later one in Nodes is given a
+// numeric suffix.
+func (g *Graph) NodeIDs() map[*Node]string {
+	ids := make(map[*Node]string)
+	used := make(map[string]bool)
+	for _, n := range g.Nodes {
+		base := nodeID(n.fn.Name)
+		id := base
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[id] = true
+		ids[n] = id
+	}
+	return ids
+}
+
+// nodeID converts a function name to an identifier.
+func nodeID(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '_':
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	if id := sb.String(); id != "" && !('0' <= id[0] && id[0] <= '9') {
+		return id
+	}
+	return "f" + sb.String()
+}
+
+// NodeStats is the statistics of the body of a function in the graph.
+type NodeStats struct {
+	Stmts    int `json:"stmts"`    // Number of statements (including nested).
+	NewChans int `json:"newchans"` // Number of channel creations.
+	Sends    int `json:"sends"`    // Number of sends (including select cases).
+	Recvs    int `json:"recvs"`    // Number of receives (including select cases).
+	Closes   int `json:"closes"`   // Number of channel closes.
+	Selects  int `json:"selects"`  // Number of selects.
+	Calls    int `json:"calls"`    // Number of calls.
+	Spawns   int `json:"spawns"`   // Number of spawns.
+	MemOps   int `json:"memops"`   // Number of memory declarations and accesses.
+	LockOps  int `json:"lockops"`  // Number of mutex declarations and operations.
+}
+
+// ChanOps returns the number of channel operations.
+func (s NodeStats) ChanOps() int {
+	return s.NewChans + s.Sends + s.Recvs + s.Closes
+}
+
+// Stats returns the statistics of the function of Node n.
+func (n *Node) Stats() NodeStats {
+	var stats NodeStats
+	stats.add(n.fn.Stmts)
+	return stats
+}
+
+func (s *NodeStats) add(stmts []migo.Statement) {
+	for _, stmt := range stmts {
+		s.Stmts++
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			s.NewChans++
+		case *migo.SendStatement:
+			s.Sends++
+		case *migo.RecvStatement:
+			s.Recvs++
+		case *migo.CloseStatement:
+			s.Closes++
+		case *migo.SelectStatement:
+			s.Selects++
+			for _, c := range stmt.Cases {
+				s.add(c)
+			}
+		case *migo.IfStatement:
+			s.add(stmt.Then)
+			s.add(stmt.Else)
+		case *migo.IfForStatement:
+			s.add(stmt.Then)
+			s.add(stmt.Else)
+		case *migo.CallStatement:
+			s.Calls++
+		case *migo.SpawnStatement:
+			s.Spawns++
+		case *migo.NewMem, *migo.MemRead, *migo.MemWrite:
+			s.MemOps++
+		case *migo.NewSyncMutex, *migo.SyncMutexLock, *migo.SyncMutexUnlock:
+			s.LockOps++
+		case *migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock,
+			*migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
+			s.LockOps++
+		case migo.CustomStatement:
+			for _, c := range stmt.Children() {
+				s.add(c)
+			}
+		}
+	}
+}
+
+// MermaidString returns a string representation of the graph
+// as a Mermaid flowchart, e.g. for embedding in Markdown documents.
+//
+// Spawn edges are dotted.
+func (g *Graph) MermaidString() string {
+	id := g.NodeIDs()
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	for _, n := range g.Nodes {
+		name := strings.Replace(n.fn.Name, `"`, "#quot;", -1)
+		sb.WriteString(fmt.Sprintf("    %s[\"%s\"]\n", id[n], name))
+	}
+	for _, e := range g.Edges() {
+		arrow := "-->"
+		if e.Kind&SpawnEdge != 0 {
+			arrow = "-.->"
+		}
+		sb.WriteString(fmt.Sprintf("    %s %s|%s| %s\n", id[e.From], arrow, e.Kind, id[e.To]))
+	}
+	return sb.String()
+}
+
+// GraphML returns a string representation of the graph in GraphML format,
+// e.g. for yEd or Gephi.
+//
+// Nodes are annotated with their function name and NodeStats,
+// and edges are annotated with their kind.
+func (g *Graph) GraphML() string {
+	id := g.NodeIDs()
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	buf.WriteString(`  <key id="name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	for _, key := range graphMLStatsKeys {
+		buf.WriteString(fmt.Sprintf(`  <key id="%s" for="node" attr.name="%s" attr.type="int"/>`+"\n", key, key))
+	}
+	buf.WriteString(`  <key id="kind" for="edge" attr.name="kind" attr.type="string"/>` + "\n")
+	buf.WriteString(`  <graph id="G" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		buf.WriteString(fmt.Sprintf(`    <node id="%s">`+"\n", id[n]))
+		buf.WriteString(`      <data key="name">`)
+		xml.EscapeText(&buf, []byte(n.fn.Name))
+		buf.WriteString("</data>\n")
+		stats := n.Stats()
+		for i, v := range []int{stats.Stmts, stats.ChanOps(), stats.Selects, stats.Calls, stats.Spawns, stats.MemOps, stats.LockOps} {
+			buf.WriteString(fmt.Sprintf(`      <data key="%s">%d</data>`+"\n", graphMLStatsKeys[i], v))
+		}
+		buf.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges() {
+		buf.WriteString(fmt.Sprintf(`    <edge id="e%d" source="%s" target="%s">`+"\n", i, id[e.From], id[e.To]))
+		buf.WriteString(fmt.Sprintf(`      <data key="kind">%s</data>`+"\n", e.Kind))
+		buf.WriteString("    </edge>\n")
+	}
+	buf.WriteString("  </graph>\n")
+	buf.WriteString("</graphml>\n")
+	return buf.String()
+}
+
+var graphMLStatsKeys = []string{"stmts", "chanops", "selects", "calls", "spawns", "memops", "lockops"}
+
+// jsonGraph is the JSON representation of a Graph.
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	ChanOps int       `json:"chanops"`
+	Stats   NodeStats `json:"stats"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// MarshalJSON encodes the graph as a JSON node and edge list.
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	id := g.NodeIDs()
+	jg := jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	for _, n := range g.Nodes {
+		stats := n.Stats()
+		jg.Nodes = append(jg.Nodes, jsonNode{ID: id[n], Name: n.fn.Name, ChanOps: stats.ChanOps(), Stats: stats})
+	}
+	for _, e := range g.Edges() {
+		jg.Edges = append(jg.Edges, jsonEdge{From: id[e.From], To: id[e.To], Kind: e.Kind.String()})
+	}
+	return json.Marshal(jg)
+}
@@ -0,0 +1,151 @@
+package ctrlflow_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/internal/ctrlflow"
+	"github.com/nickng/migo/v3/parser"
+)
+
+const exportProg = `
+def main.main(): let ch = newchan T, 0; call main_main(ch); spawn f(ch); recv ch;
+def main_main(c): send c;
+def f(c): select case send c; case recv c; endselect; close c;
+`
+
+func TestNodeIDs(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(exportProg))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := g.NodeIDs()
+	// main.main and main_main collide.
+	for i, want := range []string{"main_main", "main_main_2", "f"} {
+		if got := ids[g.Nodes[i]]; want != got {
+			t.Errorf("node[%d]: expected ID %s but got %s", i, want, got)
+		}
+	}
+	if dot := g.DotString(); !strings.Contains(dot, `main_main -> f [style=dashed,label="spawn"];`) {
+		t.Errorf("expected dashed spawn edge in dot output:\n%s", dot)
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(exportProg))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := g.Nodes[2].Stats() // f
+	if want, got := 4, stats.Stmts; want != got {
+		t.Errorf("expected %d statements but got %d", want, got)
+	}
+	if want, got := 3, stats.ChanOps(); want != got {
+		t.Errorf("expected %d channel operations but got %d", want, got)
+	}
+	if want, got := 1, stats.Selects; want != got {
+		t.Errorf("expected %d select but got %d", want, got)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(exportProg))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	want := `graph TD
+    main_main["main.main"]
+    main_main_2["main_main"]
+    f["f"]
+    main_main -->|call| main_main_2
+    main_main -.->|spawn| f
+`
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.MermaidString(); want != got {
+		t.Errorf("unexpected mermaid output, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+func TestGraphML(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(exportProg))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var doc struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"graph>edge"`
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal([]byte(g.GraphML()), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, len(doc.Nodes); want != got {
+		t.Errorf("expected %d nodes but got %d", want, got)
+	}
+	if want, got := 2, len(doc.Edges); want != got {
+		t.Errorf("expected %d edges but got %d", want, got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(exportProg))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var graph struct {
+		Nodes []struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			ChanOps int    `json:"chanops"`
+		} `json:"nodes"`
+		Edges []struct {
+			From, To, Kind string
+		} `json:"edges"`
+	}
+	if err := json.Unmarshal(b, &graph); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, len(graph.Nodes); want != got {
+		t.Fatalf("expected %d nodes but got %d", want, got)
+	}
+	if want, got := 2, graph.Nodes[0].ChanOps; want != got {
+		t.Errorf("expected %d channel operations in %s but got %d", want, graph.Nodes[0].Name, got)
+	}
+	if want, got := "spawn", graph.Edges[1].Kind; want != got {
+		t.Errorf("expected %s edge but got %s", want, got)
+	}
+}
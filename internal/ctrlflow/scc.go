@@ -0,0 +1,198 @@
+package ctrlflow
+
+// This file contains structural queries on the function-level Graph:
+// strongly connected components, recursion and reachability.
+
+import (
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// EdgeKind is the kind of a Graph edge, i.e. how the caller
+// invokes the callee. An edge can be both a CallEdge and a SpawnEdge.
+type EdgeKind int
+
+const (
+	CallEdge  EdgeKind = 1 << iota // Callee is called (call).
+	SpawnEdge                      // Callee is spawned (spawn).
+)
+
+func (k EdgeKind) String() string {
+	var kinds []string
+	if k&CallEdge != 0 {
+		kinds = append(kinds, "call")
+	}
+	if k&SpawnEdge != 0 {
+		kinds = append(kinds, "spawn")
+	}
+	return strings.Join(kinds, "+")
+}
+
+// Edge is an edge in a Graph.
+type Edge struct {
+	From, To *Node
+	Kind     EdgeKind
+}
+
+// Edges returns all edges of the graph, ordered by
+// the caller then the callee position in Nodes.
+func (g *Graph) Edges() []Edge {
+	var edges []Edge
+	for _, n := range g.Nodes {
+		for _, s := range n.Succs {
+			edges = append(edges, Edge{From: n, To: s, Kind: g.EdgeKind(n, s)})
+		}
+	}
+	return edges
+}
+
+// EdgeKind returns the kind of the edge from Node from to Node to,
+// or 0 if there are no such edge.
+func (g *Graph) EdgeKind(from, to *Node) EdgeKind {
+	return g.edges[from][to]
+}
+
+// Node returns the Node of Function fn in the graph.
+func (g *Graph) Node(fn *migo.Function) (*Node, bool) {
+	n, ok := g.nodes[fn]
+	return n, ok
+}
+
+// SCCs returns the strongly connected components of the graph
+// in reverse topological order, i.e. every component is listed after all the
+// components it calls or spawns. Iterating over the result visits the
+// condensation of the graph bottom-up.
+//
+// Nodes within a component are in the same order as in Nodes.
+func (g *Graph) SCCs() [][]*Node {
+	t := tarjan{
+		index:   make(map[*Node]int),
+		lowlink: make(map[*Node]int),
+		onStack: make(map[*Node]bool),
+	}
+	for _, n := range g.Nodes {
+		if _, visited := t.index[n]; !visited {
+			t.strongConnect(n)
+		}
+	}
+	pos := make(map[*Node]int)
+	for i, n := range g.Nodes {
+		pos[n] = i
+	}
+	for _, scc := range t.sccs {
+		for i := 1; i < len(scc); i++ { // insertion sort by position
+			for j := i; j > 0 && pos[scc[j]] < pos[scc[j-1]]; j-- {
+				scc[j], scc[j-1] = scc[j-1], scc[j]
+			}
+		}
+	}
+	return t.sccs
+}
+
+// tarjan holds temporary data for Tarjan's SCC algorithm.
+type tarjan struct {
+	next    int
+	index   map[*Node]int
+	lowlink map[*Node]int
+	onStack map[*Node]bool
+	stack   []*Node
+	sccs    [][]*Node
+}
+
+func (t *tarjan) strongConnect(n *Node) {
+	t.index[n] = t.next
+	t.lowlink[n] = t.next
+	t.next++
+	t.stack = append(t.stack, n)
+	t.onStack[n] = true
+
+	for _, s := range n.Succs {
+		if _, visited := t.index[s]; !visited {
+			t.strongConnect(s)
+			if t.lowlink[s] < t.lowlink[n] {
+				t.lowlink[n] = t.lowlink[s]
+			}
+		} else if t.onStack[s] && t.index[s] < t.lowlink[n] {
+			t.lowlink[n] = t.index[s]
+		}
+	}
+
+	if t.lowlink[n] == t.index[n] { // n is root of a component
+		var scc []*Node
+		for {
+			top := t.stack[len(t.stack)-1]
+			t.stack = t.stack[:len(t.stack)-1]
+			t.onStack[top] = false
+			scc = append(scc, top)
+			if top == n {
+				break
+			}
+		}
+		t.sccs = append(t.sccs, scc)
+	}
+}
+
+// isRecursive returns true if the component scc is recursive,
+// i.e. has more than one node or a node calling itself.
+func (g *Graph) isRecursive(scc []*Node) bool {
+	return len(scc) > 1 || g.EdgeKind(scc[0], scc[0]) != 0
+}
+
+// Recursive returns the Nodes of (mutually) recursive functions,
+// in the same order as in Nodes.
+func (g *Graph) Recursive() []*Node {
+	recursive := make(map[*Node]bool)
+	for _, scc := range g.SCCs() {
+		if g.isRecursive(scc) {
+			for _, n := range scc {
+				recursive[n] = true
+			}
+		}
+	}
+	var nodes []*Node
+	for _, n := range g.Nodes {
+		if recursive[n] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// SpawnsInRecursion returns the spawn edges originating from
+// (mutually) recursive functions. Each of these spawns can be executed
+// an unbounded number of times, creating unbounded number of goroutines.
+func (g *Graph) SpawnsInRecursion() []Edge {
+	recursive := make(map[*Node]bool)
+	for _, n := range g.Recursive() {
+		recursive[n] = true
+	}
+	var edges []Edge
+	for _, e := range g.Edges() {
+		if recursive[e.From] && e.Kind&SpawnEdge != 0 {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// Reachable returns the set of Nodes reachable from
+// any of the entries (including the entries).
+func (g *Graph) Reachable(entries ...*Node) map[*Node]bool {
+	reachable := make(map[*Node]bool)
+	queue := append([]*Node{}, entries...)
+	for _, n := range entries {
+		reachable[n] = true
+	}
+	var n *Node
+	for len(queue) > 0 {
+		n, queue = queue[0], queue[1:]
+		for _, s := range n.Succs {
+			if !reachable[s] {
+				reachable[s] = true
+				queue = append(queue, s)
+			}
+		}
+	}
+	return reachable
+}
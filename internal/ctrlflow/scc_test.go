@@ -0,0 +1,111 @@
+package ctrlflow_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/internal/ctrlflow"
+	"github.com/nickng/migo/v3/parser"
+)
+
+func nodeNames(nodes []*ctrlflow.Node) string {
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Func().Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSCCs(t *testing.T) {
+	s := `
+def main(): call a(); spawn d();
+def a(): call b();
+def b(): call c(); call a();
+def c(): tau;
+def d(): call d();
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sccs := g.SCCs()
+	// Bottom-up: c, {a,b}, d, main
+	want := []string{"c", "a,b", "d", "main"}
+	if len(want) != len(sccs) {
+		t.Fatalf("expected %d components but got %d", len(want), len(sccs))
+	}
+	for i := range want {
+		if got := nodeNames(sccs[i]); want[i] != got {
+			t.Errorf("component[%d]: expected {%s} but got {%s}", i, want[i], got)
+		}
+	}
+	if want, got := "a,b,d", nodeNames(g.Recursive()); want != got {
+		t.Errorf("expected recursive functions {%s} but got {%s}", want, got)
+	}
+}
+
+func TestSpawnsInRecursion(t *testing.T) {
+	s := `
+def main(): call loop(); spawn w();
+def loop(): spawn w(); call w(); call loop();
+def w(): send x;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := g.SpawnsInRecursion()
+	if want, got := 1, len(edges); want != got {
+		t.Fatalf("expected %d spawn in recursion but got %d", want, got)
+	}
+	if want, got := "loop", edges[0].From.Func().Name; want != got {
+		t.Errorf("expected spawn from %s but got %s", want, got)
+	}
+	if want, got := ctrlflow.CallEdge|ctrlflow.SpawnEdge, edges[0].Kind; want != got {
+		t.Errorf("expected %s edge but got %s", want, got)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	s := `
+def main(): call a();
+def a(): spawn b();
+def b(): tau;
+def c(): call d();
+def d(): call c(); call a();
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	g, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainfn, _ := prog.Function("main")
+	entry, ok := g.Node(mainfn)
+	if !ok {
+		t.Fatal("main function not found in graph")
+	}
+	reachable := g.Reachable(entry)
+	var names []string
+	for _, n := range g.Nodes {
+		if reachable[n] {
+			names = append(names, n.Func().Name)
+		}
+	}
+	if want, got := "main,a,b", strings.Join(names, ","); want != got {
+		t.Errorf("expected reachable {%s} but got {%s}", want, got)
+	}
+}
@@ -0,0 +1,216 @@
+// Package canon defines a transformation pass to rename variables and
+// functions to canonical names.
+//
+// Names in extracted programs are derived from the SSA form of the Go
+// source, and change between extractions of the same program. Canonical
+// names only depend on the structure of the program, so that equivalent
+// programs have equal output.
+//
+// Variables of each function are renamed with the fresh name generator of
+// the function (see migo.Function.FreshName) in the order of definition,
+// with a prefix of their kind:
+//
+//	p  parameter
+//	ch channel (let)
+//	m  memory (letmem)
+//	mu mutex (letsync mutex)
+//	rw rwmutex (letsync rwmutex)
+//
+// e.g. def f(p0, p1): let ch2 = newchan ch2, 0; letmem m3; ...
+//
+// The instance label of a newchan is renamed to the name of its variable,
+// as the labels are derived from the SSA form too.
+//
+// Functions are optionally renamed f0, f1, ... in the depth-first order of
+// calls and spawns from the kept functions, followed by the functions not
+// reachable from them in the order of the program.
+//
+// Free names which are not parameters (e.g. globals) are not renamed, and
+// fresh names never clash with them. Functions with a migo.CustomStatement
+// are not renamed, as their variables cannot be renamed.
+package canon
+
+import (
+	"fmt"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+// Options is the options of canonical renaming.
+type Options struct {
+	Funcs bool     // Rename functions as well as variables.
+	Keep  []string // Functions not renamed, e.g. entry functions.
+}
+
+// Renaming is the renaming of a program.
+type Renaming struct {
+	// Funcs maps the old name of each renamed function to its new name.
+	Funcs map[string]string
+
+	// Vars maps the new name of each variable to its old name, in each
+	// function (by the new function name). Names are mapped from new to
+	// old as a name declared more than once has more than one new name.
+	Vars map[string]map[string]string
+}
+
+// Rename renames the variables, and functions if opts.Funcs is set,
+// of Program prog to canonical names, and returns the renaming.
+func Rename(prog *migo.Program, opts Options) *Renaming {
+	vars := make(map[*migo.Function]map[string]string)
+	for _, fn := range prog.Funcs {
+		if v, ok := renameVars(fn); ok {
+			vars[fn] = v
+		}
+	}
+	r := &Renaming{Funcs: make(map[string]string), Vars: make(map[string]map[string]string)}
+	if opts.Funcs {
+		r.Funcs = renameFuncs(prog, opts.Keep)
+	}
+	for fn, v := range vars {
+		r.Vars[fn.Name] = v
+	}
+	return r
+}
+
+// prefix returns the prefix of the fresh name of a variable declared by decl.
+func prefix(decl migo.Statement) string {
+	switch decl.(type) {
+	case *migo.NewMem:
+		return "m"
+	case *migo.NewSyncMutex:
+		return "mu"
+	case *migo.NewSyncRWMutex:
+		return "rw"
+	}
+	return "ch"
+}
+
+// renameVars renames the variables of function fn, and returns the map
+// from new to old names. It returns false if fn cannot be renamed.
+func renameVars(fn *migo.Function) (map[string]string, bool) {
+	free := subst.Free(fn.Stmts)
+	for _, p := range fn.Params {
+		delete(free, p.Callee.Name())
+	}
+	fresh := func(prefix string) string {
+		for {
+			if x := fn.FreshName(prefix); !free[x] {
+				return x
+			}
+		}
+	}
+	fn.ResetFreshNames()
+	vars := make(map[string]string)
+	env := make(map[string]string)
+	params := make([]*migo.Parameter, len(fn.Params))
+	for i, p := range fn.Params {
+		x := fresh("p")
+		env[p.Callee.Name()] = x
+		vars[x] = p.Callee.Name()
+		params[i] = &migo.Parameter{Caller: subst.Var(x), Callee: subst.Var(x)}
+	}
+	stmts, err := subst.Stmts(fn.Stmts, env, func(name string, decl migo.Statement) string {
+		x := fresh(prefix(decl))
+		vars[x] = name
+		return x
+	})
+	if err != nil {
+		return nil, false
+	}
+	subst.Walk(stmts, func(stmt migo.Statement) {
+		if stmt, ok := stmt.(*migo.NewChanStatement); ok {
+			stmt.Chan = stmt.Name.Name()
+		}
+	})
+	fn.Params, fn.Stmts = params, stmts
+	return vars, true
+}
+
+// renameFuncs renames the functions of Program prog except keep,
+// and returns the map from old to new names.
+func renameFuncs(prog *migo.Program, keep []string) map[string]string {
+	reserved := make(map[string]bool) // names which are not renamed
+	for _, name := range keep {
+		reserved[name] = true
+	}
+	for _, fn := range prog.Funcs {
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if name := callee(stmt); name != "" {
+				if _, defined := prog.Function(name); !defined {
+					reserved[name] = true
+				}
+			}
+		})
+	}
+	var order []*migo.Function
+	visited := make(map[*migo.Function]bool)
+	var visit func(fn *migo.Function)
+	visit = func(fn *migo.Function) {
+		if visited[fn] {
+			return
+		}
+		visited[fn] = true
+		order = append(order, fn)
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if c, ok := prog.Function(callee(stmt)); ok {
+				visit(c)
+			}
+		})
+	}
+	for _, name := range keep {
+		if fn, ok := prog.Function(name); ok {
+			visit(fn)
+		}
+	}
+	for _, fn := range prog.Funcs {
+		visit(fn)
+	}
+
+	next := 0
+	fresh := func() string {
+		for {
+			name := fmt.Sprintf("f%d", next)
+			next++
+			if !reserved[name] {
+				return name
+			}
+		}
+	}
+	renamed := make(map[string]string)
+	for _, fn := range order {
+		if !reserved[fn.Name] {
+			renamed[fn.Name] = fresh()
+		}
+	}
+	for _, fn := range prog.Funcs {
+		if name, ok := renamed[fn.Name]; ok {
+			fn.Name = name
+		}
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			switch stmt := stmt.(type) {
+			case *migo.CallStatement:
+				if name, ok := renamed[stmt.Name]; ok {
+					stmt.Name = name
+				}
+			case *migo.SpawnStatement:
+				if name, ok := renamed[stmt.Name]; ok {
+					stmt.Name = name
+				}
+			}
+		})
+	}
+	return renamed
+}
+
+// callee returns the name of the function called or spawned by stmt,
+// or empty string if stmt is not a call or spawn.
+func callee(stmt migo.Statement) string {
+	switch stmt := stmt.(type) {
+	case *migo.CallStatement:
+		return stmt.Name
+	case *migo.SpawnStatement:
+		return stmt.Name
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package canon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests that programs differing only in names are renamed to the same program.
+func TestRename(t *testing.T) {
+	srcs := []string{`
+def main(): let t0 = newchan main.t0_chan0, 0; letmem t1; spawn main.worker#3(t0, t1); recv t0;
+def main.worker#3(a, b): write b; send a; call main.worker#3(a, b);
+`, `
+def main(): let t4 = newchan main.t4_chan0, 0; letmem t7; spawn main.worker#7(t4, t7); recv t4;
+def main.worker#7(x, y): write y; send x; call main.worker#7(x, y);
+`}
+	want := `def main():
+    let ch0 = newchan ch0, 0;
+    letmem m1;
+    spawn f0(ch0, m1);
+    recv ch0;
+def f0(p0, p1):
+    write p1;
+    send p0;
+    call f0(p0, p1);
+`
+	for i, s := range srcs {
+		prog, err := parser.Parse(strings.NewReader(s))
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		r := Rename(prog, Options{Funcs: true, Keep: []string{"main"}})
+		if got := prog.String(); want != got {
+			t.Errorf("%d: unexpected renaming, want:\n%sgot:\n%s", i, want, got)
+		}
+		if want, got := 1, len(r.Funcs); want != got {
+			t.Errorf("%d: expects %d function renamed but got %d: %v", i, want, got, r.Funcs)
+		}
+		if want, got := []string{"t0", "t4"}[i], r.Vars["main"]["ch0"]; want != got {
+			t.Errorf("%d: expects ch0 renamed from %s but got %s", i, want, got)
+		}
+	}
+}
+
+// Tests that fresh names do not clash with free names.
+func TestRenameFree(t *testing.T) {
+	s := `def f(a): let b = newchan b, 0; send ch1; send p0; send b; send a;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	Rename(prog, Options{})
+	if want, got := `def f(p1):
+    let ch2 = newchan ch2, 0;
+    send ch1;
+    send p0;
+    send ch2;
+    send p1;
+`, prog.String(); want != got {
+		t.Errorf("unexpected renaming, want:\n%sgot:\n%s", want, got)
+	}
+}
@@ -1,51 +1,98 @@
 // Package deadcall defines a transformation pass to remove dead function calls.
 //
 // Dead functions calls are calls (or spawns) to functions that are not defined.
+// Conditionals and selects which are reduced to τ after removing dead calls,
+// i.e. all branches or cases are τ, are also removed.
+// In the nested blocks of a migo.CustomStatement, which cannot be resized,
+// the statements removed are replaced by τ.
 package deadcall
 
-import "github.com/nickng/migo/v3"
+import (
+	"fmt"
 
-// Remove removes undefined function calls and spawns.
-func Remove(prog *migo.Program) {
-	rmvr := undefRemover{prog: prog}
+	"github.com/nickng/migo/v3"
+)
+
+// Removed is a statement removed by Remove.
+type Removed struct {
+	Func   *migo.Function // Function containing the statement.
+	Stmt   migo.Statement // Statement removed.
+	Reason string         // Reason of removal.
+}
+
+func (r Removed) String() string {
+	return fmt.Sprintf("%s: %s: %s", r.Func.Name, r.Stmt, r.Reason)
+}
+
+// Remove removes undefined function calls and spawns,
+// and returns the statements removed.
+func Remove(prog *migo.Program) []Removed {
+	rmvr := &undefRemover{prog: prog}
 	for i := range prog.Funcs {
-		rmvr.traverse(&prog.Funcs[i].Stmts)
+		rmvr.fn = prog.Funcs[i]
+		rmvr.traverse(&prog.Funcs[i].Stmts, false)
 	}
+	return rmvr.removed
 }
 
 type undefRemover struct {
-	prog *migo.Program
+	prog    *migo.Program
+	fn      *migo.Function // function being traversed
+	removed []Removed
+}
+
+func (r *undefRemover) remove(stmt migo.Statement, reason string) {
+	r.removed = append(r.removed, Removed{Func: r.fn, Stmt: stmt, Reason: reason})
 }
 
-func (r undefRemover) traverse(stmts *[]migo.Statement) {
+// traverse removes the dead statements in *stmts, or replaces them by τ if
+// fixed, i.e. *stmts is a nested block of a migo.CustomStatement.
+func (r *undefRemover) traverse(stmts *[]migo.Statement, fixed bool) {
 	ss := *stmts
 	for i := 0; i < len(ss); i++ {
+		drop := func(reason string) {
+			r.remove(ss[i], reason)
+			if fixed {
+				ss[i] = &migo.TauStatement{}
+				return
+			}
+			ss[i] = nil
+			ss = append(ss[:i], ss[i+1:]...)
+			i--
+		}
 		switch stmt := (ss)[i].(type) {
 		case *migo.IfStatement:
-			r.traverse(&stmt.Then)
-			r.traverse(&stmt.Else)
-			if len(stmt.Then) == 1 {
-				_, isThenTau := stmt.Then[0].(*migo.TauStatement)
-				if len(stmt.Else) == 1 {
-					_, isElseTau := stmt.Else[0].(*migo.TauStatement)
-					if isThenTau && isElseTau { // if tau; else tau; endif;
-						ss[i] = nil
-						ss = append(ss[:i], ss[i+1:]...)
-						i--
-					}
-				}
+			r.traverse(&stmt.Then, false)
+			r.traverse(&stmt.Else, false)
+			if isTau(stmt.Then) && isTau(stmt.Else) { // if tau; else tau; endif;
+				drop("both branches are τ")
+			}
+		case *migo.IfForStatement:
+			r.traverse(&stmt.Then, false)
+			r.traverse(&stmt.Else, false)
+			if isTau(stmt.Then) && isTau(stmt.Else) { // ifFor tau; else tau; endif;
+				drop("both branches are τ")
+			}
+		case *migo.SelectStatement:
+			allTau := len(stmt.Cases) > 0 // empty select blocks forever
+			for j := range stmt.Cases {
+				r.traverse(&stmt.Cases[j], false)
+				allTau = allTau && isTau(stmt.Cases[j])
+			}
+			if allTau { // select case tau; ... endselect;
+				drop("all cases are τ")
 			}
 		case *migo.SpawnStatement:
 			if _, found := r.prog.Function(stmt.Name); !found {
-				ss[i] = nil
-				ss = append(ss[:i], ss[i+1:]...)
-				i--
+				drop(fmt.Sprintf("function %s is removed or not defined", stmt.Name))
 			}
 		case *migo.CallStatement:
 			if _, found := r.prog.Function(stmt.Name); !found {
-				ss[i] = nil
-				ss = append(ss[:i], ss[i+1:]...)
-				i--
+				drop(fmt.Sprintf("function %s is removed or not defined", stmt.Name))
+			}
+		case migo.CustomStatement:
+			for _, c := range stmt.Children() {
+				r.traverse(&c, true)
 			}
 		}
 	}
@@ -54,3 +101,12 @@ func (r undefRemover) traverse(stmts *[]migo.Statement) {
 	}
 	*stmts = ss
 }
+
+// isTau returns true if stmts is a single τ statement.
+func isTau(stmts []migo.Statement) bool {
+	if len(stmts) == 1 {
+		_, ok := stmts[0].(*migo.TauStatement)
+		return ok
+	}
+	return false
+}
@@ -158,3 +158,48 @@ func TestRemoveUndefined3(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestRemoveUndefinedSelect(t *testing.T) {
+	s := `
+	def main():
+		select
+		case tau; call a();
+		case tau; call b();
+		endselect;
+		select
+		case recv x; call a();
+		case tau;
+		endselect;
+	def b():
+		send x;
+	`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+	}
+	if want, got := 2, len(prog.Funcs[0].Stmts); want != got {
+		t.Errorf("expecting %d statements (before removal) but got %d:\n%s", want, got, prog.Funcs[0])
+	}
+	removed := Remove(prog)
+	if want, got := 2, len(removed); want != got {
+		t.Errorf("expecting %d statements removed but got %d: %v", want, got, removed)
+	}
+	if want, got := 2, len(prog.Funcs[0].Stmts); want != got {
+		t.Errorf("expecting %d statements (after removal) but got %d:\n%s", want, got, prog.Funcs[0])
+	}
+	if sel, ok := prog.Funcs[0].Stmts[1].(*migo.SelectStatement); !ok {
+		t.Errorf("expecting a select statement but got %T", prog.Funcs[0].Stmts[1])
+	} else if want, got := 1, len(sel.Cases[0]); want != got {
+		t.Errorf("expecting %d statement in case but got %d:\n%s", want, got, sel.Cases[0])
+	}
+
+	s = `def main(): select case tau; call a(); case tau; endselect;`
+	prog, err = parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+	}
+	Remove(prog)
+	if _, ok := prog.Funcs[0].Stmts[0].(*migo.TauStatement); !ok {
+		t.Errorf("expecting select to be reduced to tau but got %s", prog.Funcs[0].Stmts[0])
+	}
+}
@@ -0,0 +1,251 @@
+// Package deadparam defines a transformation pass to remove unused
+// function parameters.
+//
+// A parameter is used if the function body uses it in a channel, memory or
+// lock operation, or passes it to a used parameter of a function it calls or
+// spawns. As the call graph may be recursive, used parameters are computed
+// as the least fixpoint:
+//
+//	Mark parameters used directly in the function bodies
+//	Repeat until no more parameters are marked:
+//		Mark parameters passed to marked parameters of a callee
+//
+// A parameter is conservatively marked used if it is passed to a function
+// which is not defined or which has a different number of parameters, or
+// if the function body contains a migo.CustomStatement.
+//
+// Unused parameters are removed from the function definitions and from
+// the arguments of every call and spawn of the functions.
+package deadparam
+
+import (
+	"fmt"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+// Removed is a parameter removed by Remove.
+type Removed struct {
+	Func  *migo.Function // Function of the parameter.
+	Param string         // Name of the parameter.
+}
+
+func (r Removed) String() string {
+	return fmt.Sprintf("%s: parameter %s is unused", r.Func.Name, r.Param)
+}
+
+// Used returns whether each parameter of each function in Program prog is
+// used, indexed by the position of the parameter in the function, where
+// all parameters of the functions named keep are used.
+//
+// An *migo.ErrUnknownStatement is returned if prog contains
+// a statement unknown to the analysis.
+func Used(prog *migo.Program, keep ...string) (map[*migo.Function][]bool, error) {
+	a := &analysis{
+		prog: prog,
+		used: make(map[*migo.Function][]bool),
+	}
+	for _, fn := range prog.Funcs {
+		a.used[fn] = make([]bool, len(fn.Params))
+	}
+	for _, name := range keep {
+		if fn, ok := prog.Function(name); ok {
+			for i := range a.used[fn] {
+				a.used[fn][i] = true
+			}
+		}
+	}
+	for _, fn := range prog.Funcs {
+		scope := make(map[string]int)
+		for i, p := range fn.Params {
+			scope[p.Callee.Name()] = i
+		}
+		a.fn = fn
+		if err := a.stmts(fn.Stmts, scope); err != nil {
+			return nil, err
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, e := range a.flows {
+			if a.used[e.callee][e.calleeParam] && !a.used[e.caller][e.callerParam] {
+				a.used[e.caller][e.callerParam] = true
+				changed = true
+			}
+		}
+	}
+	return a.used, nil
+}
+
+// Remove removes unused parameters of the functions in Program prog
+// except the functions named keep, and returns the parameters removed.
+//
+// An *migo.ErrUnknownStatement is returned if prog contains
+// a statement unknown to the pass, and prog is left unchanged.
+func Remove(prog *migo.Program, keep ...string) ([]Removed, error) {
+	used, err := Used(prog, keep...)
+	if err != nil {
+		return nil, err
+	}
+	var removed []Removed
+	for _, fn := range prog.Funcs {
+		params := fn.Params[:0]
+		for i, p := range fn.Params {
+			if used[fn][i] {
+				params = append(params, p)
+			} else {
+				removed = append(removed, Removed{Func: fn, Param: p.Callee.Name()})
+			}
+		}
+		fn.Params = params
+	}
+	// Remove the arguments of the removed parameters.
+	args := func(name string, params []*migo.Parameter) []*migo.Parameter {
+		callee, ok := prog.Function(name)
+		if !ok || len(used[callee]) != len(params) {
+			return params
+		}
+		var ps []*migo.Parameter
+		for i, p := range params {
+			if used[callee][i] {
+				ps = append(ps, p)
+			}
+		}
+		return ps
+	}
+	for _, fn := range prog.Funcs {
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			switch stmt := stmt.(type) {
+			case *migo.CallStatement:
+				stmt.Params = args(stmt.Name, stmt.Params)
+			case *migo.SpawnStatement:
+				stmt.Params = args(stmt.Name, stmt.Params)
+			}
+		})
+	}
+	return removed, nil
+}
+
+// flow is a parameter of a caller passed to a parameter of a callee.
+type flow struct {
+	caller      *migo.Function
+	callerParam int
+	callee      *migo.Function
+	calleeParam int
+}
+
+type analysis struct {
+	prog  *migo.Program
+	fn    *migo.Function // function being analysed
+	used  map[*migo.Function][]bool
+	flows []flow
+}
+
+// use marks name used if it is a parameter in scope.
+func (a *analysis) use(scope map[string]int, name string) {
+	if i, ok := scope[name]; ok {
+		a.used[a.fn][i] = true
+	}
+}
+
+// pass records the flows of parameters in scope to the parameters of
+// function name.
+func (a *analysis) pass(scope map[string]int, name string, params []*migo.Parameter) {
+	callee, ok := a.prog.Function(name)
+	for j, p := range params {
+		i, isParam := scope[p.Caller.Name()]
+		if !isParam {
+			continue
+		}
+		if !ok || len(callee.Params) != len(params) {
+			a.used[a.fn][i] = true
+			continue
+		}
+		a.flows = append(a.flows, flow{caller: a.fn, callerParam: i, callee: callee, calleeParam: j})
+	}
+}
+
+// unbind returns scope without name, which is declared (shadowed)
+// for the rest of the statements.
+func unbind(scope map[string]int, name string) map[string]int {
+	if _, ok := scope[name]; !ok {
+		return scope
+	}
+	s := make(map[string]int, len(scope))
+	for k, v := range scope {
+		if k != name {
+			s[k] = v
+		}
+	}
+	return s
+}
+
+func (a *analysis) stmts(stmts []migo.Statement, scope map[string]int) error {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			scope = unbind(scope, stmt.Name.Name())
+		case *migo.NewMem:
+			scope = unbind(scope, stmt.Name)
+		case *migo.NewSyncMutex:
+			scope = unbind(scope, stmt.Name)
+		case *migo.NewSyncRWMutex:
+			scope = unbind(scope, stmt.Name)
+		case *migo.SendStatement:
+			a.use(scope, stmt.Chan)
+		case *migo.RecvStatement:
+			a.use(scope, stmt.Chan)
+		case *migo.CloseStatement:
+			a.use(scope, stmt.Chan)
+		case *migo.MemRead:
+			a.use(scope, stmt.Name)
+		case *migo.MemWrite:
+			a.use(scope, stmt.Name)
+		case *migo.SyncMutexLock:
+			a.use(scope, stmt.Name)
+		case *migo.SyncMutexUnlock:
+			a.use(scope, stmt.Name)
+		case *migo.SyncRWMutexRLock:
+			a.use(scope, stmt.Name)
+		case *migo.SyncRWMutexRUnlock:
+			a.use(scope, stmt.Name)
+		case *migo.SyncRWMutexLock:
+			a.use(scope, stmt.Name)
+		case *migo.SyncRWMutexUnlock:
+			a.use(scope, stmt.Name)
+		case *migo.TauStatement:
+		case *migo.CallStatement:
+			a.pass(scope, stmt.Name, stmt.Params)
+		case *migo.SpawnStatement:
+			a.pass(scope, stmt.Name, stmt.Params)
+		case *migo.IfStatement:
+			if err := a.stmts(stmt.Then, scope); err != nil {
+				return err
+			}
+			if err := a.stmts(stmt.Else, scope); err != nil {
+				return err
+			}
+		case *migo.IfForStatement:
+			if err := a.stmts(stmt.Then, scope); err != nil {
+				return err
+			}
+			if err := a.stmts(stmt.Else, scope); err != nil {
+				return err
+			}
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				if err := a.stmts(c, scope); err != nil {
+					return err
+				}
+			}
+		case migo.CustomStatement:
+			for _, i := range scope { // cannot tell, all used
+				a.used[a.fn][i] = true
+			}
+		default:
+			return &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+	}
+	return nil
+}
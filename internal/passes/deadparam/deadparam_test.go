@@ -0,0 +1,100 @@
+package deadparam
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests removal of parameters unused transitively through calls and spawns.
+func TestRemove(t *testing.T) {
+	s := `
+def main(): let a = newchan a, 0; let b = newchan b, 0; spawn f(a, b); recv a;
+def f(x, y): send x; call g(y, x);
+def g(p, q): call h(p); spawn h(q); call undef(q);
+def h(z): call h(z);
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	removed, err := Remove(prog, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range removed {
+		got = append(got, r.String())
+	}
+	if want := "f: parameter y is unused, g: parameter p is unused, h: parameter z is unused"; want != strings.Join(got, ", ") {
+		t.Errorf("unexpected parameters removed, want:\n%s\ngot:\n%s", want, strings.Join(got, ", "))
+	}
+	if want, got := `def main():
+    let a = newchan a, 0;
+    let b = newchan b, 0;
+    spawn f(a);
+    recv a;
+def f(x):
+    send x;
+    call g(x);
+def g(q):
+    call h();
+    spawn h();
+    call undef(q);
+def h():
+    call h();
+`, prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests that shadowed parameters are not used.
+func TestRemoveShadowed(t *testing.T) {
+	s := `def f(x, y): if let x = newchan x, 0; send x; else send y; endif; recv y;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	used, err := Used(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "[false true]", fmt.Sprint(used[prog.Funcs[0]]); want != got {
+		t.Errorf("expects used parameters %s but got %s", want, got)
+	}
+}
+
+// Tests that parameters passed to kept functions are used.
+func TestRemoveKeep(t *testing.T) {
+	s := `
+def main(): let c = newchan c, 0; call f(c);
+def f(x): call g(x);
+def g(y): tau;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	removed, err := Remove(prog, "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(removed); want != got {
+		t.Errorf("expected %d parameters removed but got %d: %v", want, got, removed)
+	}
+	if want, got := `def main():
+    let c = newchan c, 0;
+    call f(c);
+def f(x):
+    call g(x);
+def g(y):
+    tau;
+`, prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,241 @@
+// Package deadres defines a transformation pass to remove dead resources.
+//
+// Dead resources are channels, memory locations and mutexes declared in a
+// function body (let, letmem and letsync) whose names are never used in
+// the scope of the declaration, i.e. not used in any statement nor passed
+// to any function. Creating a dead resource reduces to τ, so the
+// declarations are removed.
+//
+// Names passed only to functions which ignore them are still used, remove
+// the unused parameters (see package deadparam) before this pass.
+package deadres
+
+import (
+	"fmt"
+
+	"github.com/nickng/migo/v3"
+)
+
+// Removed is a declaration removed by Remove.
+type Removed struct {
+	Func   *migo.Function // Function containing the declaration.
+	Stmt   migo.Statement // Declaration removed.
+	Reason string         // Reason of removal.
+}
+
+func (r Removed) String() string {
+	return fmt.Sprintf("%s: %s: %s", r.Func.Name, r.Stmt, r.Reason)
+}
+
+// Remove removes dead resource declarations from Program prog,
+// and returns the declarations removed.
+//
+// An *migo.ErrUnknownStatement is returned if prog contains
+// a statement unknown to the pass, and prog is left unchanged.
+func Remove(prog *migo.Program) ([]Removed, error) {
+	var dead []Removed
+	for _, fn := range prog.Funcs {
+		stmts, err := findDead(fn.Stmts)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range stmts {
+			dead = append(dead, Removed{Func: fn, Stmt: stmt, Reason: declared(stmt) + " is never used"})
+		}
+	}
+	isDead := make(map[migo.Statement]bool)
+	for _, r := range dead {
+		isDead[r.Stmt] = true
+	}
+	for _, fn := range prog.Funcs {
+		fn.Stmts = remove(fn.Stmts, isDead)
+	}
+	return dead, nil
+}
+
+// declared returns the name declared by stmt,
+// or empty string if stmt is not a declaration.
+func declared(stmt migo.Statement) string {
+	switch stmt := stmt.(type) {
+	case *migo.NewChanStatement:
+		return stmt.Name.Name()
+	case *migo.NewMem:
+		return stmt.Name
+	case *migo.NewSyncMutex:
+		return stmt.Name
+	case *migo.NewSyncRWMutex:
+		return stmt.Name
+	}
+	return ""
+}
+
+// findDead returns the dead declarations in stmts (including nested).
+func findDead(stmts []migo.Statement) ([]migo.Statement, error) {
+	var dead []migo.Statement
+	for i, stmt := range stmts {
+		if name := declared(stmt); name != "" {
+			used, err := uses(stmts[i+1:], name)
+			if err != nil {
+				return nil, err
+			}
+			if !used {
+				dead = append(dead, stmt)
+			}
+			continue
+		}
+		var children [][]migo.Statement
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			children = [][]migo.Statement{stmt.Then, stmt.Else}
+		case *migo.IfForStatement:
+			children = [][]migo.Statement{stmt.Then, stmt.Else}
+		case *migo.SelectStatement:
+			children = stmt.Cases
+		case migo.CustomStatement:
+			// Declarations in custom statements are not removed.
+		case *migo.CloseStatement, *migo.SendStatement, *migo.RecvStatement, *migo.TauStatement,
+			*migo.CallStatement, *migo.SpawnStatement,
+			*migo.MemRead, *migo.MemWrite,
+			*migo.SyncMutexLock, *migo.SyncMutexUnlock,
+			*migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock,
+			*migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
+		default:
+			return nil, &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+		for _, c := range children {
+			d, err := findDead(c)
+			if err != nil {
+				return nil, err
+			}
+			dead = append(dead, d...)
+		}
+	}
+	return dead, nil
+}
+
+// uses returns true if name is used in stmts,
+// until it is declared again (shadowed).
+func uses(stmts []migo.Statement, name string) (bool, error) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement, *migo.NewMem, *migo.NewSyncMutex, *migo.NewSyncRWMutex:
+			if declared(stmt) == name {
+				return false, nil
+			}
+		case *migo.SendStatement:
+			if stmt.Chan == name {
+				return true, nil
+			}
+		case *migo.RecvStatement:
+			if stmt.Chan == name {
+				return true, nil
+			}
+		case *migo.CloseStatement:
+			if stmt.Chan == name {
+				return true, nil
+			}
+		case *migo.MemRead:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.MemWrite:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.SyncMutexLock:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.SyncMutexUnlock:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.SyncRWMutexRLock:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.SyncRWMutexRUnlock:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.SyncRWMutexLock:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.SyncRWMutexUnlock:
+			if stmt.Name == name {
+				return true, nil
+			}
+		case *migo.TauStatement:
+		case *migo.CallStatement:
+			for _, p := range stmt.Params {
+				if p.Caller.Name() == name {
+					return true, nil
+				}
+			}
+		case *migo.SpawnStatement:
+			for _, p := range stmt.Params {
+				if p.Caller.Name() == name {
+					return true, nil
+				}
+			}
+		case *migo.IfStatement:
+			if used, err := usesAny(name, stmt.Then, stmt.Else); used || err != nil {
+				return used, err
+			}
+		case *migo.IfForStatement:
+			if used, err := usesAny(name, stmt.Then, stmt.Else); used || err != nil {
+				return used, err
+			}
+		case *migo.SelectStatement:
+			if used, err := usesAny(name, stmt.Cases...); used || err != nil {
+				return used, err
+			}
+		case migo.CustomStatement:
+			return true, nil // cannot tell
+		default:
+			return false, &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+	}
+	return false, nil
+}
+
+// usesAny returns true if name is used in any of bodies.
+func usesAny(name string, bodies ...[]migo.Statement) (bool, error) {
+	for _, body := range bodies {
+		if used, err := uses(body, name); used || err != nil {
+			return used, err
+		}
+	}
+	return false, nil
+}
+
+// remove returns stmts without the statements in dead (including nested).
+// A block emptied by the removal is replaced by τ, so that the printed
+// program parses back to the same program. Blocks which were empty are
+// left empty.
+func remove(stmts []migo.Statement, dead map[migo.Statement]bool) []migo.Statement {
+	ss := stmts[:0]
+	for _, stmt := range stmts {
+		if declared(stmt) != "" && dead[stmt] {
+			continue
+		}
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			stmt.Then = remove(stmt.Then, dead)
+			stmt.Else = remove(stmt.Else, dead)
+		case *migo.IfForStatement:
+			stmt.Then = remove(stmt.Then, dead)
+			stmt.Else = remove(stmt.Else, dead)
+		case *migo.SelectStatement:
+			for i := range stmt.Cases {
+				stmt.Cases[i] = remove(stmt.Cases[i], dead)
+			}
+		}
+		ss = append(ss, stmt)
+	}
+	if len(ss) == 0 && len(stmts) > 0 {
+		return []migo.Statement{&migo.TauStatement{}}
+	}
+	return ss
+}
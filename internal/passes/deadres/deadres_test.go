@@ -0,0 +1,90 @@
+package deadres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests removal of unused declarations.
+func TestRemove(t *testing.T) {
+	s := `
+def main():
+	let a = newchan a, 0;
+	let b = newchan b, 1;
+	letmem m;
+	letsync l mutex;
+	letsync rw rwmutex;
+	if lock l; else let a = newchan a, 0; endif;
+	spawn f(b);
+	send a;
+def f(x): send x;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	removed, err := Remove(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range removed {
+		got = append(got, r.String())
+	}
+	if want := "main: letmem m: m is never used, main: letsync rw rwmutex: rw is never used, main: let a = newchan a, 0: a is never used"; want != strings.Join(got, ", ") {
+		t.Errorf("unexpected declarations removed, want:\n%s\ngot:\n%s", want, strings.Join(got, ", "))
+	}
+	if want, got := `def main():
+    let a = newchan a, 0;
+    let b = newchan b, 1;
+    letsync l mutex;
+    if lock l; else tau; endif;
+    spawn f(b);
+    send a;
+`, prog.Funcs[0].String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests that blocks emptied by the removal are printed as τ, and that the
+// result parses back to the same program.
+func TestRemoveRoundTrip(t *testing.T) {
+	s := `
+def main():
+	if let a = newchan a, 0; else tau; endif;
+	select case recv c; letmem m; case tau; endselect;
+	call f();
+def f(): letsync l mutex;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := Remove(prog); err != nil {
+		t.Fatal(err)
+	}
+	want := `def main():
+    if tau; else tau; endif;
+    select
+      case recv c;
+      case tau;
+    endselect;
+    call f();
+def f():
+    tau;
+`
+	if got := prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+	reparsed, err := parser.Parse(strings.NewReader(prog.String()))
+	if err != nil {
+		t.Fatalf("cannot parse result: %v\n%s", err, prog)
+	}
+	if got := reparsed.String(); want != got {
+		t.Errorf("unexpected program after parsing, want:\n%sgot:\n%s", want, got)
+	}
+}
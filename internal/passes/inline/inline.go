@@ -0,0 +1,264 @@
+// Package inline defines a transformation pass to inline function calls.
+//
+// A call statement is replaced by the body of the callee, where the
+// parameters of the callee are renamed to the arguments of the call, and
+// the names declared in the body (let, letmem and letsync) are renamed to
+// fresh names if they clash with names in the caller. A call is not inlined
+// if a global name of the callee is a parameter or declared in the caller,
+// which would capture it.
+//
+// A call is inlined only if the callee
+//
+//	is defined in the program,
+//	is not (mutually) recursive,
+//	has the same number of parameters as the arguments of the call,
+//	has at most MaxCalleeSize statements, and
+//	does not contain any migo.CustomStatement,
+//
+// and the caller would have at most MaxCallerSize statements after inlining.
+// Spawn statements are never inlined, as the spawned function runs in
+// a new goroutine.
+//
+// Callees are inlined bottom-up in the call graph, so chains of calls are
+// collapsed in a single run. Functions no longer called after inlining are
+// not removed by the pass.
+package inline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/ctrlflow"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+const (
+	// DefaultMaxCalleeSize is the default maximum size of an inlined function.
+	DefaultMaxCalleeSize = 16
+
+	// DefaultMaxCallerSize is the default maximum size of a function
+	// after inlining.
+	DefaultMaxCallerSize = 256
+)
+
+// Options is the size thresholds of inlining,
+// where size is the number of statements including nested statements.
+type Options struct {
+	MaxCalleeSize int // Maximum size of an inlined function.
+	MaxCallerSize int // Maximum size of a function after inlining.
+}
+
+// Inlined is a call inlined by the pass.
+type Inlined struct {
+	Caller *migo.Function      // Function containing the call.
+	Call   *migo.CallStatement // Call replaced by the body of Callee.
+	Callee *migo.Function      // Function inlined.
+}
+
+func (i Inlined) String() string {
+	return fmt.Sprintf("%s in def %s: inlined def %s", i.Call, i.Caller.Name, i.Callee.Name)
+}
+
+// Inline inlines calls in Program prog with the size thresholds in opts,
+// and returns the calls inlined. If a threshold in opts is not positive,
+// its default is used.
+//
+// An *migo.ErrUnknownStatement is returned if prog contains a statement
+// unknown to the pass, and prog is left unchanged: the bodies of the
+// functions are only replaced once all of them are inlined.
+func Inline(prog *migo.Program, opts Options) ([]Inlined, error) {
+	if opts.MaxCalleeSize <= 0 {
+		opts.MaxCalleeSize = DefaultMaxCalleeSize
+	}
+	if opts.MaxCallerSize <= 0 {
+		opts.MaxCallerSize = DefaultMaxCallerSize
+	}
+	graph, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		return nil, err
+	}
+	in := &inliner{
+		prog:      prog,
+		opts:      opts,
+		recursive: make(map[*migo.Function]bool),
+		globals:   make(map[string]bool),
+		bodies:    make(map[*migo.Function][]migo.Statement),
+	}
+	for _, n := range graph.Recursive() {
+		in.recursive[n.Func()] = true
+	}
+	for _, fn := range prog.Funcs {
+		for x := range subst.Free(fn.Stmts) {
+			if !isParam(fn, x) {
+				in.globals[x] = true
+			}
+		}
+	}
+	for _, scc := range graph.SCCs() { // callees before callers
+		for _, n := range scc {
+			fn := n.Func()
+			in.caller = fn
+			in.size = subst.Size(fn.Stmts)
+			in.used = subst.Names(fn.Stmts)
+			in.bound = make(map[string]bool)
+			for _, p := range fn.Params {
+				in.used[p.Callee.Name()] = true
+				in.bound[p.Callee.Name()] = true
+			}
+			subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+				if x := subst.Declared(stmt); x != "" {
+					in.bound[x] = true
+				}
+			})
+			for x := range in.globals {
+				in.used[x] = true
+			}
+			if in.bodies[fn], err = in.stmts(fn.Stmts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for fn, body := range in.bodies {
+		fn.Stmts = body
+	}
+	return in.inlined, nil
+}
+
+// isParam returns true if x is a parameter of fn.
+func isParam(fn *migo.Function, x string) bool {
+	for _, p := range fn.Params {
+		if p.Callee.Name() == x {
+			return true
+		}
+	}
+	return false
+}
+
+type inliner struct {
+	prog      *migo.Program
+	opts      Options
+	recursive map[*migo.Function]bool
+	globals   map[string]bool                     // Free names of functions which are not parameters.
+	bodies    map[*migo.Function][]migo.Statement // Bodies after inlining, set at the end.
+	inlined   []Inlined
+
+	caller *migo.Function  // Function being inlined into.
+	size   int             // Current size of caller.
+	used   map[string]bool // Names used in caller, and globals.
+	bound  map[string]bool // Parameters and names declared in caller.
+	avoid  map[string]bool // Names used in callee being inlined.
+}
+
+// body returns the body of fn, after inlining if fn is inlined into.
+func (in *inliner) body(fn *migo.Function) []migo.Statement {
+	if body, ok := in.bodies[fn]; ok {
+		return body
+	}
+	return fn.Stmts
+}
+
+// stmts returns stmts with calls inlined.
+func (in *inliner) stmts(stmts []migo.Statement) ([]migo.Statement, error) {
+	var err error
+	ss := make([]migo.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			body, err := in.inline(stmt)
+			if err != nil {
+				return nil, err
+			}
+			if body == nil {
+				ss = append(ss, stmt)
+				continue
+			}
+			ss = append(ss, body...)
+		case *migo.IfStatement:
+			s := &migo.IfStatement{}
+			if s.Then, err = in.stmts(stmt.Then); err != nil {
+				return nil, err
+			}
+			if s.Else, err = in.stmts(stmt.Else); err != nil {
+				return nil, err
+			}
+			ss = append(ss, s)
+		case *migo.IfForStatement:
+			s := &migo.IfForStatement{ForCond: stmt.ForCond}
+			if s.Then, err = in.stmts(stmt.Then); err != nil {
+				return nil, err
+			}
+			if s.Else, err = in.stmts(stmt.Else); err != nil {
+				return nil, err
+			}
+			ss = append(ss, s)
+		case *migo.SelectStatement:
+			s := &migo.SelectStatement{Cases: make([][]migo.Statement, len(stmt.Cases))}
+			for i := range stmt.Cases {
+				if s.Cases[i], err = in.stmts(stmt.Cases[i]); err != nil {
+					return nil, err
+				}
+			}
+			ss = append(ss, s)
+		default:
+			ss = append(ss, stmt)
+		}
+	}
+	return ss, nil
+}
+
+// inline returns the body of the callee of call to replace call with,
+// or nil if call cannot be inlined, e.g. if a global of the callee is bound
+// in the caller.
+func (in *inliner) inline(call *migo.CallStatement) ([]migo.Statement, error) {
+	callee, ok := in.prog.Function(call.Name)
+	if !ok || in.recursive[callee] || len(callee.Params) != len(call.Params) {
+		return nil, nil
+	}
+	stmts := in.body(callee)
+	size := subst.Size(stmts)
+	if size > in.opts.MaxCalleeSize || in.size-1+size > in.opts.MaxCallerSize {
+		return nil, nil
+	}
+	for x := range subst.Free(stmts) {
+		if !isParam(callee, x) && in.bound[x] {
+			return nil, nil
+		}
+	}
+	env := make(map[string]string)
+	for i, p := range callee.Params {
+		env[p.Callee.Name()] = call.Params[i].Caller.Name()
+	}
+	in.avoid = subst.Names(stmts)
+	body, err := subst.Stmts(stmts, env, in.fresh)
+	if err != nil {
+		var errUnknown *migo.ErrUnknownStatement
+		if errors.As(err, &errUnknown) {
+			if _, isCustom := errUnknown.Stmt.(migo.CustomStatement); isCustom {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+	for x := range subst.Names(body) {
+		in.used[x] = true
+	}
+	in.size += size - 1
+	in.inlined = append(in.inlined, Inlined{Caller: in.caller, Call: call, Callee: callee})
+	if len(body) == 0 {
+		return []migo.Statement{}, nil
+	}
+	return body, nil
+}
+
+// fresh returns name if it is not used in the caller, otherwise a fresh
+// name derived from name which is not used in the caller nor the callee,
+// nor a global of the program.
+func (in *inliner) fresh(name string, _ migo.Statement) string {
+	x := name
+	for i := 1; in.used[x] || (x != name && in.avoid[x]); i++ {
+		x = fmt.Sprintf("%s_%d", name, i)
+	}
+	in.used[x] = true
+	return x
+}
@@ -0,0 +1,163 @@
+package inline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests inlining a chain of calls with parameter renaming.
+func TestInlineChain(t *testing.T) {
+	s := `
+def main(): let c = newchan c, 0; call a(c); recv c;
+def a(x): call b(x); send x;
+def b(y): send y;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	inlined, err := Inline(prog, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(inlined); want != got {
+		t.Errorf("expects %d calls inlined but got %d: %v", want, got, inlined)
+	}
+	mainfn, _ := prog.Function("main")
+	if want, got := `def main():
+    let c = newchan c, 0;
+    send c;
+    send c;
+    recv c;
+`, mainfn.String(); want != got {
+		t.Errorf("unexpected inlined function, want:\n%sgot:\n%s", want, got)
+	}
+	if want, got := 3, len(prog.Funcs); want != got {
+		t.Errorf("expects %d functions (inlined functions kept) but got %d", want, got)
+	}
+}
+
+// Tests that names declared in the callee do not capture caller names.
+func TestInlineFreshen(t *testing.T) {
+	s := `
+def main(): let x = newchan x, 0; call a(x); call a(x); close x;
+def a(y): let x = newchan x, 1; send x; send y;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := Inline(prog, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	mainfn, _ := prog.Function("main")
+	if want, got := `def main():
+    let x = newchan x, 0;
+    let x_1 = newchan x, 1;
+    send x_1;
+    send x;
+    let x_2 = newchan x, 1;
+    send x_2;
+    send x;
+    close x;
+`, mainfn.String(); want != got {
+		t.Errorf("unexpected inlined function, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests that names are not freshened to globals of callees, and that
+// globals of callees are not captured by the caller.
+func TestInlineGlobal(t *testing.T) {
+	s := `
+def main(): let x = newchan x, 0; call a(); call b(); call c(); close x;
+def a(): let x = newchan x, 1; send x;
+def b(): send x_1;
+def c(): send x;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := Inline(prog, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	mainfn, _ := prog.Function("main")
+	if want, got := `def main():
+    let x = newchan x, 0;
+    let x_2 = newchan x, 1;
+    send x_2;
+    send x_1;
+    call c();
+    close x;
+`, mainfn.String(); want != got {
+		t.Errorf("unexpected inlined function, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests that recursive functions and spawns are not inlined.
+func TestInlineRecursiveSpawn(t *testing.T) {
+	s := `
+def main(): spawn a(); call r(); call b();
+def a(): send x;
+def r(): send x; call r();
+def b(): call a();
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := Inline(prog, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	mainfn, _ := prog.Function("main")
+	if want, got := `def main():
+    spawn a();
+    call r();
+    send x;
+`, mainfn.String(); want != got {
+		t.Errorf("unexpected inlined function, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests the size thresholds.
+func TestInlineSize(t *testing.T) {
+	s := `
+def main(): call a(); call b();
+def a(): send x; send x;
+def b(): if send x; else recv x; endif;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	inlined, err := Inline(prog, Options{MaxCalleeSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(inlined); want != got {
+		t.Fatalf("expects %d calls inlined but got %d: %v", want, got, inlined)
+	}
+	if want, got := "a", inlined[0].Callee.Name; want != got {
+		t.Errorf("expects %s inlined but got %s", want, got)
+	}
+
+	prog, err = parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	inlined, err = Inline(prog, Options{MaxCallerSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(inlined); want != got {
+		t.Errorf("expects %d calls inlined but got %d: %v", want, got, inlined)
+	}
+}
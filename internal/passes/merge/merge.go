@@ -0,0 +1,173 @@
+// Package merge defines a transformation pass to merge duplicate functions.
+//
+// Two functions are duplicates if they are alpha-equivalent, i.e. their
+// bodies are equal up to renaming of parameters and declared names, where
+// calls and spawns of duplicate functions are considered equal. Channel
+// labels of newchan statements are not renamed, i.e. must be equal.
+// For example, w1 and w2 below are duplicates (and so are a1 and a2):
+//
+//	def w1(x): send x; call a1(x);
+//	def a1(y): recv y; call w1(y);
+//	def w2(z): send z; call a2(z);
+//	def a2(y): recv y; call w2(y);
+//
+// Duplicates are found by partition refinement: functions are first
+// partitioned by the shape of their bodies with callee names abstracted,
+// and partitions are split until the callees of functions in the same
+// partition are pairwise in the same partition.
+//
+// Each partition is then merged into one representative function, which is
+// the first function of the partition in the program, and all calls and
+// spawns of the other functions are redirected to the representative.
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+// Merged is a function merged into another function by the pass.
+type Merged struct {
+	Func *migo.Function // Function removed.
+	Into *migo.Function // Representative function Func is merged into.
+}
+
+func (m Merged) String() string {
+	return fmt.Sprintf("%s: merged into %s", m.Func.Name, m.Into.Name)
+}
+
+// Merge merges duplicate functions in Program prog, except the functions
+// named keep, and returns the functions merged.
+//
+// A function named keep is never removed, but can be the representative
+// of its duplicates, in which case it is preferred to other functions.
+// Functions with a migo.CustomStatement are not merged.
+func Merge(prog *migo.Program, keep ...string) []Merged {
+	kept := make(map[string]bool)
+	for _, name := range keep {
+		kept[name] = true
+	}
+	class := partition(prog)
+
+	into := make(map[int]*migo.Function) // class → representative
+	for _, fn := range prog.Funcs {
+		if rep, ok := into[class[fn]]; !ok || (kept[fn.Name] && !kept[rep.Name]) {
+			into[class[fn]] = fn
+		}
+	}
+	var merged []Merged
+	redirect := make(map[string]string)
+	funcs := make([]*migo.Function, 0, len(prog.Funcs))
+	for _, fn := range prog.Funcs {
+		if rep := into[class[fn]]; rep != fn && !kept[fn.Name] {
+			merged = append(merged, Merged{Func: fn, Into: rep})
+			redirect[fn.Name] = rep.Name
+			continue
+		}
+		funcs = append(funcs, fn)
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	prog.Funcs = funcs
+	for _, fn := range prog.Funcs {
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			switch stmt := stmt.(type) {
+			case *migo.CallStatement:
+				if name, ok := redirect[stmt.Name]; ok {
+					stmt.Name = name
+				}
+			case *migo.SpawnStatement:
+				if name, ok := redirect[stmt.Name]; ok {
+					stmt.Name = name
+				}
+			}
+		})
+	}
+	return merged
+}
+
+// partition returns the partition of the functions in Program prog,
+// where duplicate functions are in the same class.
+func partition(prog *migo.Program) map[*migo.Function]int {
+	class := make(map[*migo.Function]int)
+	callees := make(map[*migo.Function][]string)
+	ids := make(map[string]int)
+	for _, fn := range prog.Funcs {
+		key, names, ok := shape(fn)
+		if !ok { // unique class
+			key = fmt.Sprintf("%p", fn)
+		}
+		if _, exists := ids[key]; !exists {
+			ids[key] = len(ids)
+		}
+		class[fn] = ids[key]
+		callees[fn] = names
+	}
+	for n := len(ids); ; {
+		ids = make(map[string]int)
+		refined := make(map[*migo.Function]int)
+		for _, fn := range prog.Funcs {
+			var sb strings.Builder
+			sb.WriteString(fmt.Sprintf("%d", class[fn]))
+			for _, name := range callees[fn] {
+				if callee, ok := prog.Function(name); ok {
+					sb.WriteString(fmt.Sprintf(" %d", class[callee]))
+				} else { // undefined function
+					sb.WriteString(fmt.Sprintf(" %q", name))
+				}
+			}
+			key := sb.String()
+			if _, exists := ids[key]; !exists {
+				ids[key] = len(ids)
+			}
+			refined[fn] = ids[key]
+		}
+		class = refined
+		if len(ids) == n { // stable
+			return class
+		}
+		n = len(ids)
+	}
+}
+
+// shape returns a string representation of the body of function fn with
+// parameters and declared names renamed by position and callee names
+// abstracted, and the callee names in order.
+//
+// shape returns false if the body of fn cannot be renamed.
+func shape(fn *migo.Function) (string, []string, bool) {
+	env := make(map[string]string)
+	for i, p := range fn.Params {
+		env[p.Callee.Name()] = fmt.Sprintf("%%p%d", i)
+	}
+	n := 0
+	stmts, err := subst.Stmts(fn.Stmts, env, func(string, migo.Statement) string {
+		n++
+		return fmt.Sprintf("%%v%d", n)
+	})
+	if err != nil {
+		return "", nil, false
+	}
+	var names []string
+	subst.Walk(stmts, func(stmt migo.Statement) {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			names = append(names, stmt.Name)
+			stmt.Name = "%f"
+		case *migo.SpawnStatement:
+			names = append(names, stmt.Name)
+			stmt.Name = "%f"
+		}
+	})
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("(%d)", len(fn.Params)))
+	for _, stmt := range stmts {
+		sb.WriteString(stmt.String())
+		sb.WriteString(";")
+	}
+	return sb.String(), names, true
+}
@@ -0,0 +1,96 @@
+package merge
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests merging of alpha-equivalent functions.
+// Channel labels (newchan ch) are not renamed.
+func TestMerge(t *testing.T) {
+	s := `
+def main(): let a = newchan a, 0; spawn w1(a); spawn w2(a); call w3(a);
+def w1(x): let c = newchan ch, 1; send c; send x;
+def w2(y): let d = newchan ch, 1; send d; send y;
+def w3(z): let d = newchan ch, 1; send d; recv z;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	merged := Merge(prog, "main")
+	if want, got := 1, len(merged); want != got {
+		t.Fatalf("expects %d function merged but got %d: %v", want, got, merged)
+	}
+	if want, got := "w2: merged into w1", merged[0].String(); want != got {
+		t.Errorf("expects %s but got %s", want, got)
+	}
+	if want, got := `def main():
+    let a = newchan a, 0;
+    spawn w1(a);
+    spawn w1(a);
+    call w3(a);
+`, prog.Funcs[0].String(); want != got {
+		t.Errorf("unexpected redirected function, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests merging of mutually recursive duplicates.
+func TestMergeRecursive(t *testing.T) {
+	s := `
+def main(): spawn w1(a); call w2(b);
+def w1(x): send x; call a1(x);
+def a1(y): recv y; call w1(y);
+def w2(z): send z; call a2(z);
+def a2(y): recv y; call w2(y);
+def w3(z): send z; call a3(z);
+def a3(y): recv y; call w1(y);
+def w4(z): send z; call a4(z);
+def a4(y): send y; call w4(y);
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	merged := Merge(prog)
+	var got []string
+	for _, m := range merged {
+		got = append(got, m.String())
+	}
+	if want := "w2: merged into w1, a2: merged into a1, w3: merged into w1, a3: merged into a1, a4: merged into w4"; want != strings.Join(got, ", ") {
+		t.Errorf("unexpected merges, want:\n%s\ngot:\n%s", want, strings.Join(got, ", "))
+	}
+	if want, got := 4, len(prog.Funcs); want != got {
+		t.Errorf("expects %d functions after merge but got %d:\n%s", want, got, prog)
+	}
+	if want, got := "def main():\n    spawn w1(a);\n    call w1(b);\n", prog.Funcs[0].String(); want != got {
+		t.Errorf("unexpected redirected function, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests that kept functions are not removed but preferred as representative.
+func TestMergeKeep(t *testing.T) {
+	s := `
+def a(): send x; call b();
+def b(): send x; call a();
+def main(): send x; call main();
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	merged := Merge(prog, "main")
+	if want, got := 2, len(merged); want != got {
+		t.Fatalf("expects %d functions merged but got %d: %v", want, got, merged)
+	}
+	for _, m := range merged {
+		if want, got := "main", m.Into.Name; want != got {
+			t.Errorf("expects %s merged into %s but got %s", m.Func.Name, want, got)
+		}
+	}
+}
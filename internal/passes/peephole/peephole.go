@@ -0,0 +1,237 @@
+// Package peephole defines a transformation pass of local algebraic
+// simplifications of statements.
+//
+// The rewrite rules are (where S, T, U are sequences of statements):
+//
+//	CollapseTau:   tau; tau; S                      ⇒ tau; S
+//	DropTau:       tau; s; S                        ⇒ s; S          (s is not tau)
+//	               S; s; tau                        ⇒ S; s
+//	IfEqual:       if S; else S; endif              ⇒ S
+//	IfHoist:       if U; S; else U; T; endif        ⇒ U; if S; else T; endif
+//	               if S; U; else T; U; endif        ⇒ if S; else T; endif; U
+//	SelectDedupe:  select case S; case S; ...       ⇒ select case S; ...
+//	SelectFlatten: select case s; S; endselect      ⇒ s; S
+//
+// where branches are equal if they are alpha-equivalent, i.e. equal up to
+// renaming of declared names, and branches of only τ are equal to empty
+// branches. The guard (first statement) of a select case is never dropped.
+// Rules which move statements to another scope (IfEqual,
+// IfHoist and SelectFlatten) do not apply to declarations (let, letmem and
+// letsync) as they would change the scope of the declared names: IfEqual
+// and SelectFlatten do not apply if S declares names, IfHoist does not
+// hoist declarations, and does not hoist a suffix if S or T declares names.
+//
+// The rules are applied bottom-up until none of the rules apply.
+// A migo.CustomStatement is never rewritten.
+package peephole
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+// Rule is a rewrite rule.
+type Rule int
+
+const (
+	CollapseTau   Rule = iota // Collapse consecutive τ.
+	DropTau                   // Drop τ preceding or following another statement.
+	IfEqual                   // Replace if with equal branches by the branch.
+	IfHoist                   // Hoist common prefix or suffix out of if branches.
+	SelectDedupe              // Remove duplicate select cases.
+	SelectFlatten             // Replace select with one case by the case.
+)
+
+func (r Rule) String() string {
+	switch r {
+	case CollapseTau:
+		return "collapse-tau"
+	case DropTau:
+		return "drop-tau"
+	case IfEqual:
+		return "if-equal"
+	case IfHoist:
+		return "if-hoist"
+	case SelectDedupe:
+		return "select-dedupe"
+	case SelectFlatten:
+		return "select-flatten"
+	}
+	return fmt.Sprintf("Rule(%d)", int(r))
+}
+
+// Rewrite applies the rewrite rules to the functions in Program prog,
+// and returns the number of times each rule is applied.
+func Rewrite(prog *migo.Program) map[Rule]int {
+	r := &rewriter{count: make(map[Rule]int)}
+	for _, fn := range prog.Funcs {
+		for {
+			n := r.total()
+			fn.Stmts = r.stmts(fn.Stmts, false)
+			if r.total() == n {
+				break
+			}
+		}
+	}
+	return r.count
+}
+
+type rewriter struct {
+	count map[Rule]int
+}
+
+func (r *rewriter) total() int {
+	n := 0
+	for _, c := range r.count {
+		n += c
+	}
+	return n
+}
+
+// stmts rewrites stmts, where stmts[0] is a select guard if guarded.
+func (r *rewriter) stmts(stmts []migo.Statement, guarded bool) []migo.Statement {
+	ss := make([]migo.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			stmt.Then = r.stmts(stmt.Then, false)
+			stmt.Else = r.stmts(stmt.Else, false)
+			ss = append(ss, r.ifStmt(stmt)...)
+		case *migo.IfForStatement:
+			stmt.Then = r.stmts(stmt.Then, false)
+			stmt.Else = r.stmts(stmt.Else, false)
+			ss = append(ss, stmt)
+		case *migo.SelectStatement:
+			for i := range stmt.Cases {
+				stmt.Cases[i] = r.stmts(stmt.Cases[i], true)
+			}
+			ss = append(ss, r.selectStmt(stmt)...)
+		default:
+			ss = append(ss, stmt)
+		}
+	}
+	// τ rules.
+	res := ss[:0]
+	for i, stmt := range ss {
+		if _, isTau := stmt.(*migo.TauStatement); isTau && i+1 < len(ss) && !(guarded && i == 0) {
+			if _, nextTau := ss[i+1].(*migo.TauStatement); nextTau {
+				r.count[CollapseTau]++
+			} else {
+				r.count[DropTau]++
+			}
+			continue
+		}
+		if _, isTau := stmt.(*migo.TauStatement); isTau && len(res) > 0 && i+1 == len(ss) {
+			r.count[DropTau]++
+			continue
+		}
+		res = append(res, stmt)
+	}
+	return res
+}
+
+// ifStmt returns the statements to replace stmt with.
+func (r *rewriter) ifStmt(stmt *migo.IfStatement) []migo.Statement {
+	if onlyTau(stmt.Then) && onlyTau(stmt.Else) {
+		r.count[IfEqual]++
+		return nil
+	}
+	if !declares(stmt.Then) && equal(stmt.Then, stmt.Else) {
+		r.count[IfEqual]++
+		return stmt.Then
+	}
+	var prefix, suffix []migo.Statement
+	for len(stmt.Then) > 0 && len(stmt.Else) > 0 && !declares(stmt.Then[:1]) && equal(stmt.Then[:1], stmt.Else[:1]) {
+		prefix = append(prefix, stmt.Then[0])
+		stmt.Then, stmt.Else = stmt.Then[1:], stmt.Else[1:]
+	}
+	if !declares(stmt.Then) && !declares(stmt.Else) {
+		for len(stmt.Then) > 0 && len(stmt.Else) > 0 && equal(stmt.Then[len(stmt.Then)-1:], stmt.Else[len(stmt.Else)-1:]) {
+			suffix = append([]migo.Statement{stmt.Then[len(stmt.Then)-1]}, suffix...)
+			stmt.Then, stmt.Else = stmt.Then[:len(stmt.Then)-1], stmt.Else[:len(stmt.Else)-1]
+		}
+	}
+	if len(prefix) > 0 || len(suffix) > 0 {
+		r.count[IfHoist]++
+	}
+	ss := append(prefix, stmt)
+	return append(ss, suffix...)
+}
+
+// selectStmt returns the statements to replace stmt with.
+func (r *rewriter) selectStmt(stmt *migo.SelectStatement) []migo.Statement {
+	var cases [][]migo.Statement
+	for _, c := range stmt.Cases {
+		dup := false
+		for _, prev := range cases {
+			if equal(c, prev) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			r.count[SelectDedupe]++
+			continue
+		}
+		cases = append(cases, c)
+	}
+	stmt.Cases = cases
+	if len(stmt.Cases) == 1 && !declares(stmt.Cases[0]) {
+		r.count[SelectFlatten]++
+		return stmt.Cases[0]
+	}
+	return []migo.Statement{stmt}
+}
+
+// onlyTau returns true if stmts is empty or only has τ statements.
+func onlyTau(stmts []migo.Statement) bool {
+	for _, stmt := range stmts {
+		if _, isTau := stmt.(*migo.TauStatement); !isTau {
+			return false
+		}
+	}
+	return true
+}
+
+// declares returns true if stmts has a declaration (not nested).
+func declares(stmts []migo.Statement) bool {
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *migo.NewChanStatement, *migo.NewMem, *migo.NewSyncMutex, *migo.NewSyncRWMutex:
+			return true
+		}
+	}
+	return false
+}
+
+// equal returns true if stmts1 and stmts2 are alpha-equivalent.
+// Statements which cannot be renamed are never equal.
+func equal(stmts1, stmts2 []migo.Statement) bool {
+	if len(stmts1) != len(stmts2) {
+		return false
+	}
+	s1, ok1 := canonical(stmts1)
+	s2, ok2 := canonical(stmts2)
+	return ok1 && ok2 && s1 == s2
+}
+
+// canonical returns a string representation of stmts
+// with declared names renamed by position.
+func canonical(stmts []migo.Statement) (string, bool) {
+	n := 0
+	ss, err := subst.Stmts(stmts, nil, func(string, migo.Statement) string {
+		n++
+		return fmt.Sprintf("%%v%d", n)
+	})
+	if err != nil {
+		return "", false
+	}
+	strs := make([]string, len(ss))
+	for i, s := range ss {
+		strs[i] = s.String()
+	}
+	return strings.Join(strs, "; "), true
+}
@@ -0,0 +1,50 @@
+package peephole
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests each rewrite rule, where rule -1 means no rule applies.
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		rule Rule
+	}{
+		{"collapse", `def f(): tau; tau; tau;`, "tau", CollapseTau},
+		{"drop", `def f(): tau; send x; tau;`, "send x", DropTau},
+		{"if-equal", `def f(): if let a = newchan a, 0; send a; else let b = newchan b, 0; send b; endif;`,
+			"if let a = newchan a, 0; send a; else let b = newchan b, 0; send b; endif", -1},
+		{"if-equal-nodecl", `def f(): if send x; recv y; else send x; recv y; endif;`, "send x; recv y", IfEqual},
+		{"if-hoist", `def f(): if send x; recv y; close z; else send x; close z; endif;`,
+			"send x; if recv y; else endif; close z", IfHoist},
+		{"if-hoist-decl", `def f(): if let a = newchan a, 0; send a; else let a = newchan a, 0; recv a; endif;`,
+			"if let a = newchan a, 0; send a; else let a = newchan a, 0; recv a; endif", -1},
+		{"select-dedupe", `def f(): select case recv x; send y; case recv x; send y; case tau; endselect;`,
+			"select case recv x; send y; case tau; endselect", SelectDedupe},
+		{"select-flatten", `def f(): select case tau; send y; case tau; send y; endselect;`, "send y", SelectFlatten},
+		{"select-guard", `def f(): select case tau; case recv x; endselect;`, "select case tau; case recv x; endselect", -1},
+	}
+	for _, test := range tests {
+		prog, err := parser.Parse(strings.NewReader(test.src))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		count := Rewrite(prog)
+		var got []string
+		for _, stmt := range prog.Funcs[0].Stmts {
+			got = append(got, strings.Join(strings.Fields(stmt.String()), " "))
+		}
+		if want, got := test.want, strings.Join(got, "; "); want != got {
+			t.Errorf("%s: unexpected rewrite, want:\n%s\ngot:\n%s", test.name, want, got)
+		}
+		if test.rule >= 0 && count[test.rule] == 0 {
+			t.Errorf("%s: expects rule %s applied but got %v", test.name, test.rule, count)
+		}
+	}
+}
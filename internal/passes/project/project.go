@@ -0,0 +1,119 @@
+// Package project defines a transformation pass to project a program
+// onto a fragment of the MiGo language.
+//
+// The fragments are channels (newchan, send, recv, close), memory (letmem,
+// read, write), mutexes (letsync mutex, lock, unlock) and rwmutexes (letsync
+// rwmutex, rlock, runlock). Statements of the fragments not kept are replaced
+// by τ, including the guards of select cases. The result usually needs
+// further simplification, e.g. removing the τ functions and the parameters
+// no longer used.
+//
+// The statements in the nested blocks of a migo.CustomStatement are
+// projected too, and the custom statement itself is kept.
+package project
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// Kind is a set of fragments of the MiGo language.
+type Kind int
+
+const (
+	Chan    Kind = 1 << iota // Channel primitives.
+	Mem                      // Memory primitives.
+	Mutex                    // Mutex primitives.
+	RWMutex                  // RWMutex primitives.
+
+	All = Chan | Mem | Mutex | RWMutex // All fragments.
+)
+
+func (k Kind) String() string {
+	var kinds []string
+	for _, f := range []struct {
+		kind Kind
+		name string
+	}{{Chan, "chan"}, {Mem, "mem"}, {Mutex, "mutex"}, {RWMutex, "rwmutex"}} {
+		if k&f.kind != 0 {
+			kinds = append(kinds, f.name)
+		}
+	}
+	if len(kinds) == 0 {
+		return "none"
+	}
+	return strings.Join(kinds, "+")
+}
+
+// Replaced is a statement replaced by τ by Project.
+type Replaced struct {
+	Func *migo.Function // Function containing the statement.
+	Stmt migo.Statement // Statement replaced.
+	Kind Kind           // Fragment of the statement.
+}
+
+func (r Replaced) String() string {
+	return fmt.Sprintf("%s: %s: %s primitive", r.Func.Name, r.Stmt, r.Kind)
+}
+
+// KindOf returns the fragment of stmt,
+// or 0 if stmt is not a primitive of any fragment.
+func KindOf(stmt migo.Statement) Kind {
+	switch stmt.(type) {
+	case *migo.NewChanStatement, *migo.SendStatement, *migo.RecvStatement, *migo.CloseStatement:
+		return Chan
+	case *migo.NewMem, *migo.MemRead, *migo.MemWrite:
+		return Mem
+	case *migo.NewSyncMutex, *migo.SyncMutexLock, *migo.SyncMutexUnlock:
+		return Mutex
+	case *migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock,
+		*migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
+		return RWMutex
+	}
+	return 0
+}
+
+// Project replaces the statements of Program prog not in fragments keep
+// by τ, and returns the statements replaced.
+func Project(prog *migo.Program, keep Kind) []Replaced {
+	p := &projector{keep: keep}
+	for _, fn := range prog.Funcs {
+		p.fn = fn
+		p.stmts(fn.Stmts)
+	}
+	return p.replaced
+}
+
+type projector struct {
+	keep     Kind
+	fn       *migo.Function // function being projected
+	replaced []Replaced
+}
+
+func (p *projector) stmts(stmts []migo.Statement) {
+	for i, stmt := range stmts {
+		if kind := KindOf(stmt); kind != 0 && kind&p.keep == 0 {
+			p.replaced = append(p.replaced, Replaced{Func: p.fn, Stmt: stmt, Kind: kind})
+			stmts[i] = &migo.TauStatement{}
+			continue
+		}
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			p.stmts(stmt.Then)
+			p.stmts(stmt.Else)
+		case *migo.IfForStatement:
+			p.stmts(stmt.Then)
+			p.stmts(stmt.Else)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				p.stmts(c)
+			}
+		case migo.CustomStatement:
+			for _, c := range stmt.Children() {
+				p.stmts(c)
+			}
+		}
+	}
+}
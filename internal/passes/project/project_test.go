@@ -0,0 +1,84 @@
+package project
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests projection onto the channel fragment.
+func TestProject(t *testing.T) {
+	s := `
+def main():
+	let c = newchan c, 0;
+	letmem m;
+	letsync l mutex;
+	lock l;
+	write m;
+	select case send c; read m; case tau; unlock l; endselect;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	replaced := Project(prog, Chan|Mutex)
+	if want, got := 3, len(replaced); want != got {
+		t.Errorf("expects %d statements replaced but got %d: %v", want, got, replaced)
+	}
+	if want, got := "main: letmem m: mem primitive", replaced[0].String(); want != got {
+		t.Errorf("expects %s but got %s", want, got)
+	}
+	if want, got := `def main():
+    let c = newchan c, 0;
+    tau;
+    letsync l mutex;
+    lock l;
+    tau;
+    select
+      case send c; tau;
+      case tau; unlock l;
+    endselect;
+`, prog.Funcs[0].String(); want != got {
+		t.Errorf("unexpected projection, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// loopStmt is a custom statement which repeats its body.
+type loopStmt struct {
+	body []migo.Statement
+}
+
+func (s *loopStmt) String() string               { return "loop" }
+func (s *loopStmt) Children() [][]migo.Statement { return [][]migo.Statement{s.body} }
+func (s *loopStmt) IsTau() bool                  { return true }
+
+// Tests projection of the nested blocks of custom statements.
+func TestProjectCustomStmt(t *testing.T) {
+	prog := migo.NewProgram()
+	fn := migo.NewFunction("main")
+	loop := &loopStmt{body: []migo.Statement{&migo.SendStatement{Chan: "c"}, &migo.MemWrite{Name: "m"}}}
+	fn.AddStmts(loop)
+	prog.AddFunction(fn)
+	replaced := Project(prog, Chan)
+	if want, got := 1, len(replaced); want != got {
+		t.Fatalf("expects %d statements replaced but got %d: %v", want, got, replaced)
+	}
+	if want, got := "main: write m: mem primitive", replaced[0].String(); want != got {
+		t.Errorf("expects %s but got %s", want, got)
+	}
+	if _, ok := loop.body[1].(*migo.TauStatement); !ok {
+		t.Errorf("expects write m replaced by tau but got %v", loop.body[1])
+	}
+}
+
+func TestKindString(t *testing.T) {
+	if want, got := "chan+rwmutex", (Chan | RWMutex).String(); want != got {
+		t.Errorf("expects %s but got %s", want, got)
+	}
+	if want, got := "none", Kind(0).String(); want != got {
+		t.Errorf("expects %s but got %s", want, got)
+	}
+}
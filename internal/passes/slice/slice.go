@@ -0,0 +1,193 @@
+// Package slice defines a transformation pass to slice a program
+// with respect to a set of channels.
+//
+// The channels of the slice are given by name, which is matched against
+// both the declared name (let c = ...) and the channel label (newchan ch, 0)
+// of the newchan statements, and against the global names of functions,
+// i.e. free names which are not parameters. The channels are followed
+// through parameter passing, i.e. a parameter of a function is in the slice if the caller
+// passes a channel in the slice as the argument:
+//
+//	Mark (function, name) of matching newchan statements and globals
+//	Repeat until no more names are marked:
+//		Mark (callee, parameter) for each marked name passed to a callee
+//
+// All statements are replaced by τ except the channel operations on marked
+// names, and the calls and spawns of functions which (transitively) contain
+// such operations. Control flow statements (if and select) are kept, but
+// the guards of select cases are replaced by τ if they are not in the slice.
+// The result usually needs further simplification, e.g. removing the τ
+// functions and the parameters no longer used.
+//
+// Names are tracked per function regardless of scope, so a declaration
+// shadowing a marked name is also marked. Nested statements of a
+// migo.CustomStatement are not traversed.
+package slice
+
+import (
+	"fmt"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/subst"
+)
+
+// Replaced is a statement replaced by τ by Slice.
+type Replaced struct {
+	Func *migo.Function // Function containing the statement.
+	Stmt migo.Statement // Statement replaced.
+}
+
+func (r Replaced) String() string {
+	return fmt.Sprintf("%s: %s: not in slice", r.Func.Name, r.Stmt)
+}
+
+// Slice slices Program prog with respect to the channels named chans,
+// and returns the statements replaced by τ.
+func Slice(prog *migo.Program, chans ...string) []Replaced {
+	s := &slicer{
+		prog:  prog,
+		names: make(map[*migo.Function]map[string]bool),
+		keep:  make(map[*migo.Function]bool),
+	}
+	seeds := make(map[string]bool)
+	for _, ch := range chans {
+		seeds[ch] = true
+	}
+	for _, fn := range prog.Funcs {
+		s.names[fn] = make(map[string]bool)
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if stmt, ok := stmt.(*migo.NewChanStatement); ok && (seeds[stmt.Name.Name()] || seeds[stmt.Chan]) {
+				s.names[fn][stmt.Name.Name()] = true
+			}
+		})
+		params := make(map[string]bool)
+		for _, p := range fn.Params {
+			params[p.Callee.Name()] = true
+		}
+		for x := range subst.Free(fn.Stmts) {
+			if seeds[x] && !params[x] {
+				s.names[fn][x] = true
+			}
+		}
+	}
+	s.propagate()
+	for _, fn := range prog.Funcs {
+		s.fn = fn
+		s.stmts(fn.Stmts)
+	}
+	return s.replaced
+}
+
+type slicer struct {
+	prog     *migo.Program
+	names    map[*migo.Function]map[string]bool // names in slice of each function
+	keep     map[*migo.Function]bool            // functions with operations in slice
+	fn       *migo.Function                     // function being sliced
+	replaced []Replaced
+}
+
+// propagate marks the names passed to callees, and the functions which
+// (transitively) contain operations on the names.
+func (s *slicer) propagate() {
+	pass := func(caller *migo.Function, name string, params []*migo.Parameter) bool {
+		callee, ok := s.prog.Function(name)
+		if !ok || len(callee.Params) != len(params) {
+			return false
+		}
+		changed := false
+		for i, p := range params {
+			if s.names[caller][p.Caller.Name()] && !s.names[callee][callee.Params[i].Callee.Name()] {
+				s.names[callee][callee.Params[i].Callee.Name()] = true
+				changed = true
+			}
+		}
+		return changed
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range s.prog.Funcs {
+			subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+				switch stmt := stmt.(type) {
+				case *migo.CallStatement:
+					changed = pass(fn, stmt.Name, stmt.Params) || changed
+				case *migo.SpawnStatement:
+					changed = pass(fn, stmt.Name, stmt.Params) || changed
+				}
+			})
+		}
+	}
+	for _, fn := range s.prog.Funcs {
+		subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+			if s.inSlice(fn, stmt) {
+				s.keep[fn] = true
+			}
+		})
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range s.prog.Funcs {
+			if s.keep[fn] {
+				continue
+			}
+			subst.Walk(fn.Stmts, func(stmt migo.Statement) {
+				if s.callsKept(stmt) {
+					s.keep[fn] = true
+					changed = true
+				}
+			})
+		}
+	}
+}
+
+// inSlice returns true if stmt is a channel operation in the slice.
+func (s *slicer) inSlice(fn *migo.Function, stmt migo.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *migo.NewChanStatement:
+		return s.names[fn][stmt.Name.Name()]
+	case *migo.SendStatement:
+		return s.names[fn][stmt.Chan]
+	case *migo.RecvStatement:
+		return s.names[fn][stmt.Chan]
+	case *migo.CloseStatement:
+		return s.names[fn][stmt.Chan]
+	}
+	return false
+}
+
+// callsKept returns true if stmt calls or spawns a function in the slice.
+func (s *slicer) callsKept(stmt migo.Statement) bool {
+	var name string
+	switch stmt := stmt.(type) {
+	case *migo.CallStatement:
+		name = stmt.Name
+	case *migo.SpawnStatement:
+		name = stmt.Name
+	default:
+		return false
+	}
+	callee, ok := s.prog.Function(name)
+	return ok && s.keep[callee]
+}
+
+func (s *slicer) stmts(stmts []migo.Statement) {
+	for i, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			s.stmts(stmt.Then)
+			s.stmts(stmt.Else)
+		case *migo.IfForStatement:
+			s.stmts(stmt.Then)
+			s.stmts(stmt.Else)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				s.stmts(c)
+			}
+		case *migo.TauStatement, migo.CustomStatement:
+		default:
+			if !s.inSlice(s.fn, stmt) && !s.callsKept(stmt) {
+				s.replaced = append(s.replaced, Replaced{Func: s.fn, Stmt: stmt})
+				stmts[i] = &migo.TauStatement{}
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package slice
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests slicing following channels through parameters.
+func TestSlice(t *testing.T) {
+	s := `
+def main():
+	let a = newchan main.a, 0;
+	let b = newchan main.b, 0;
+	spawn f(a, b);
+	call g(b);
+	select case recv a; send b; case recv b; endselect;
+def f(x, y): send x; send y; call h();
+def g(z): recv z;
+def h(): letmem m; write m;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	replaced := Slice(prog, "main.a")
+	if want, got := 9, len(replaced); want != got {
+		t.Errorf("expects %d statements replaced but got %d: %v", want, got, replaced)
+	}
+	if want, got := `def main():
+    let a = newchan main.a, 0;
+    tau;
+    spawn f(a, b);
+    tau;
+    select
+      case recv a; tau;
+      case tau;
+    endselect;
+def f(x, y):
+    send x;
+    tau;
+    tau;
+def g(z):
+    tau;
+def h():
+    tau;
+    tau;
+`, prog.String(); want != got {
+		t.Errorf("unexpected slice, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Tests slicing on a global channel.
+func TestSliceGlobal(t *testing.T) {
+	s := `
+def main(): spawn f(); recv g; send c;
+def f(): send g; call h(g);
+def h(x): close x; recv c;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	Slice(prog, "g")
+	if want, got := `def main():
+    spawn f();
+    recv g;
+    tau;
+def f():
+    send g;
+    call h(g);
+def h(x):
+    close x;
+    tau;
+`, prog.String(); want != got {
+		t.Errorf("unexpected slice, want:\n%sgot:\n%s", want, got)
+	}
+}
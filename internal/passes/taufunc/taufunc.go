@@ -6,9 +6,8 @@
 //     Build control flow graph of given program
 //     Foreach function:
 //     	Mark τ if function body does not contain non control flow primitives
-//     Repeat until no changes:
-//     	Foreach non-τ function:
-//     		If CFG parent is τ: Mark parent non-τ
+//     Foreach strongly connected component of CFG (bottom-up):
+//     	If any function or CFG child is non-τ: Mark component non-τ
 //     Remove all function definitions marked as τ
 //
 // Whether a primitive is considered a τ or not is defined by the isTau method.
@@ -25,9 +24,6 @@ package taufunc
 // removes empty (i.e. no communication) migo Functions from migo Programs.
 
 import (
-	"fmt"
-	"log"
-
 	"github.com/nickng/migo/v3"
 	"github.com/nickng/migo/v3/internal/ctrlflow"
 )
@@ -39,15 +35,24 @@ import (
 // the return value indicates if fn should be removed.
 //
 // If fn is marked remove, prog will be updated accordingly.
-func Find(prog *migo.Program, visitTauFn func(fn *migo.Function) bool) {
+//
+// An *migo.ErrUnknownStatement is returned if prog contains
+// a statement unknown to the pass, and prog is left unchanged.
+func Find(prog *migo.Program, visitTauFn func(fn *migo.Function) bool) error {
+	graph, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		return err
+	}
 	tff := &tauFuncFinder{
-		graph: ctrlflow.NewGraph(prog),
+		graph: graph,
 		istau: make(map[*ctrlflow.Node]bool),
 	}
 	func2node := make(map[*migo.Function]*ctrlflow.Node)
 	for _, node := range tff.graph.Nodes {
 		func2node[node.Func()] = node
-		tff.taintTau(node)
+		if err := tff.taintTau(node); err != nil {
+			return err
+		}
 	}
 	tff.propagate()
 	for i := 0; i < len(prog.Funcs); i++ {
@@ -61,6 +66,7 @@ func Find(prog *migo.Program, visitTauFn func(fn *migo.Function) bool) {
 			}
 		}
 	}
+	return nil
 }
 
 // Remove marks taufn to be removed from its parent Program.
@@ -81,13 +87,15 @@ type tauFuncFinder struct {
 	istau map[*ctrlflow.Node]bool
 }
 
-func (t *tauFuncFinder) taintTau(n *ctrlflow.Node) {
-	t.istau[n] = t.isTau(n, n.Func().Stmts)
+func (t *tauFuncFinder) taintTau(n *ctrlflow.Node) error {
+	istau, err := t.isTau(n, n.Func().Stmts)
+	t.istau[n] = istau
+	return err
 }
 
 // isTau inspects Statements stmts and
 // returns true if all statements can be reduced to tau.
-func (t *tauFuncFinder) isTau(n *ctrlflow.Node, stmts []migo.Statement) bool {
+func (t *tauFuncFinder) isTau(n *ctrlflow.Node, stmts []migo.Statement) (bool, error) {
 	var istainted bool
 	for _, stmt := range stmts {
 		switch stmt := stmt.(type) {
@@ -104,12 +112,18 @@ func (t *tauFuncFinder) isTau(n *ctrlflow.Node, stmts []migo.Statement) bool {
 		case *migo.TauStatement:
 
 		case *migo.IfStatement:
-			istainted = istainted || !t.isTau(n, stmt.Then)
-			istainted = istainted || !t.isTau(n, stmt.Else)
+			istau, err := t.blocksTau(n, stmt.Then, stmt.Else)
+			if err != nil {
+				return false, err
+			}
+			istainted = istainted || !istau
 
 		case *migo.IfForStatement:
-			istainted = istainted || !t.isTau(n, stmt.Then)
-			istainted = istainted || !t.isTau(n, stmt.Else)
+			istau, err := t.blocksTau(n, stmt.Then, stmt.Else)
+			if err != nil {
+				return false, err
+			}
+			istainted = istainted || !istau
 
 		case *migo.CallStatement, *migo.SpawnStatement:
 			// skip for now
@@ -120,34 +134,55 @@ func (t *tauFuncFinder) isTau(n *ctrlflow.Node, stmts []migo.Statement) bool {
 		case *migo.NewSyncMutex, *migo.SyncMutexLock, *migo.SyncMutexUnlock:
 			istainted = true
 
-		case *migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock:
+		case *migo.NewSyncRWMutex, *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock,
+			*migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
 			istainted = true
 
+		case migo.CustomStatement:
+			istau, err := t.blocksTau(n, stmt.Children()...)
+			if err != nil {
+				return false, err
+			}
+			istainted = istainted || !stmt.IsTau() || !istau
+
 		default:
-			log.Fatal(fmt.Errorf("passes/taufunc: statement kind not found: %T", stmt))
+			return false, &migo.ErrUnknownStatement{Stmt: stmt}
 		}
 	}
-	return !istainted
+	return !istainted, nil
+}
+
+// blocksTau returns true if all statements of all blocks can be reduced to tau.
+func (t *tauFuncFinder) blocksTau(n *ctrlflow.Node, blocks ...[]migo.Statement) (bool, error) {
+	for _, stmts := range blocks {
+		istau, err := t.isTau(n, stmts)
+		if err != nil || !istau {
+			return false, err
+		}
+	}
+	return true, nil
 }
 
 // progpagate taints caller (CFG parent) of non-tau functions to be
-// non-tau function. Repeats until all non-tau functions are found.
+// non-tau function. The components of the CFG are visited bottom-up,
+// so the callees of a component are final when the component is visited.
 func (t *tauFuncFinder) propagate() {
-	var changed bool
-	for {
-		for _, node := range t.graph.Nodes {
+	for _, scc := range t.graph.SCCs() {
+		nontau := false
+		for _, node := range scc {
 			if !t.istau[node] {
-				for _, pred := range node.Preds {
-					if t.istau[pred] {
-						t.istau[pred] = false
-						changed = true
-					}
+				nontau = true
+			}
+			for _, succ := range node.Succs {
+				if !t.istau[succ] {
+					nontau = true
 				}
 			}
 		}
-		if !changed {
-			break // done
+		if nontau { // whole component is non-tau
+			for _, node := range scc {
+				t.istau[node] = false
+			}
 		}
-		changed = false
 	}
 }
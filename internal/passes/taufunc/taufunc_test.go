@@ -38,7 +38,9 @@ def unreachable():
 		if want, got := 5, len(prog.Funcs); want != got {
 			t.Errorf("expects %d functions but got %d", want, got)
 		}
-		Find(prog, RemoveExcept(mainfn))
+		if err := Find(prog, RemoveExcept(mainfn)); err != nil {
+			t.Fatal(err)
+		}
 		if want, got := 3, len(prog.Funcs); want != got {
 			t.Errorf("expects %d functions after removing {work,unreachable} but got %d", want, got)
 		}
@@ -66,7 +68,9 @@ def e(): tau;
 	if mainfn, found := prog.Function("main"); !found {
 		t.Errorf("main function not found")
 	} else {
-		Find(prog, RemoveExcept(mainfn))
+		if err := Find(prog, RemoveExcept(mainfn)); err != nil {
+			t.Fatal(err)
+		}
 	}
 }
 
@@ -99,7 +103,9 @@ def i(): spawn j(); call h();`
 	if mainfn, found := prog.Function("main"); !found {
 		t.Errorf("main function not found")
 	} else {
-		Find(prog, RemoveExcept(mainfn))
+		if err := Find(prog, RemoveExcept(mainfn)); err != nil {
+			t.Fatal(err)
+		}
 	}
 }
 
@@ -123,11 +129,15 @@ def e(ch): send ch;`
 		if want, got := 5, len(prog.Funcs); want != got {
 			t.Errorf("expects %d functions but got %d", want, got)
 		}
-		Find(prog, RemoveExcept(mainfn)) // main, d, e
+		if err := Find(prog, RemoveExcept(mainfn)); err != nil { // main, d, e
+			t.Fatal(err)
+		}
 		if want, got := 3, len(prog.Funcs); want != got {
 			t.Errorf("expects %d functions after removing {b,c} but got %d", want, got)
 		}
-		Find(prog, Remove) // d, e
+		if err := Find(prog, Remove); err != nil { // d, e
+			t.Fatal(err)
+		}
 		if want, got := 2, len(prog.Funcs); want != got {
 			t.Errorf("expects %d functions after removing {main} but got %d", want, got)
 		}
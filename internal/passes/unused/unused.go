@@ -1,18 +1,28 @@
 // Package unused defines a transformation pass to remove unused functions.
 //
-// The transformation works by recursively removing control flow graph
+// Remove works by recursively removing control flow graph
 // nodes that have no predecessor (caller), until all nodes in the graph
 // are called. A caveat is cycles in the graph are not removed.
+//
+// RemoveUnreachable is a mark-and-sweep variant: all functions reachable
+// from the given entry functions are marked, and all unmarked functions are
+// removed, including cycles of functions calling each other.
 package unused
 
 import (
-	"github.com/nickng/migo/internal/ctrlflow"
+	"fmt"
+	"strings"
+
 	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/ctrlflow"
 )
 
 // Remove removes all unused functions from Program prog except entry.
-func Remove(prog *migo.Program, entry *migo.Function) {
-	removeQ := findUnusedToplevel(prog)
+func Remove(prog *migo.Program, entry *migo.Function) error {
+	removeQ, err := findUnusedToplevel(prog)
+	if err != nil {
+		return err
+	}
 	var n *ctrlflow.Node
 	for len(removeQ) > 0 {
 		n, removeQ = removeQ[0], removeQ[1:]
@@ -40,16 +50,81 @@ func Remove(prog *migo.Program, entry *migo.Function) {
 			}
 		}
 	}
+	return nil
 }
 
 // findUnusedToplevel finds all unused toplevel functions.
-func findUnusedToplevel(prog *migo.Program) []*ctrlflow.Node {
+func findUnusedToplevel(prog *migo.Program) ([]*ctrlflow.Node, error) {
 	var emptyNodes []*ctrlflow.Node
-	graph := ctrlflow.NewGraph(prog)
+	graph, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		return nil, err
+	}
 	for _, node := range graph.Nodes {
 		if len(node.Preds) == 0 {
 			emptyNodes = append(emptyNodes, node)
 		}
 	}
-	return emptyNodes
+	return emptyNodes, nil
+}
+
+// Removed is a function removed by RemoveUnreachable.
+type Removed struct {
+	Func   *migo.Function
+	Reason string // Reason of removal.
+}
+
+func (r Removed) String() string {
+	return fmt.Sprintf("%s: %s", r.Func.Name, r.Reason)
+}
+
+// RemoveUnreachable removes all functions from Program prog that are not
+// reachable from any of the entries, and returns the removed functions in
+// the order they appear in prog.
+//
+// Functions that are not part of prog in entries are ignored.
+func RemoveUnreachable(prog *migo.Program, entries ...*migo.Function) ([]Removed, error) {
+	graph, err := ctrlflow.NewGraph(prog)
+	if err != nil {
+		return nil, err
+	}
+	var roots []*ctrlflow.Node
+	for _, entry := range entries {
+		if n, ok := graph.Node(entry); ok {
+			roots = append(roots, n)
+		}
+	}
+	reachable := graph.Reachable(roots...)
+
+	var removed []Removed
+	funcs := prog.Funcs[:0]
+	for _, fn := range prog.Funcs {
+		n, ok := graph.Node(fn)
+		if !ok || reachable[n] {
+			funcs = append(funcs, fn)
+			continue
+		}
+		removed = append(removed, Removed{Func: fn, Reason: unreachableReason(n, roots)})
+	}
+	for i := len(funcs); i < len(prog.Funcs); i++ {
+		prog.Funcs[i] = nil
+	}
+	prog.Funcs = funcs
+	return removed, nil
+}
+
+// unreachableReason describes why Node n is not reachable from roots.
+func unreachableReason(n *ctrlflow.Node, roots []*ctrlflow.Node) string {
+	entries := make([]string, len(roots))
+	for i, r := range roots {
+		entries[i] = r.Func().Name
+	}
+	if len(n.Preds) == 0 {
+		return fmt.Sprintf("not called by any function and unreachable from {%s}", strings.Join(entries, ", "))
+	}
+	callers := make([]string, len(n.Preds))
+	for i, p := range n.Preds {
+		callers[i] = p.Func().Name
+	}
+	return fmt.Sprintf("only called by unreachable functions {%s}", strings.Join(callers, ", "))
 }
@@ -0,0 +1,80 @@
+package unused
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests removal of unreachable mutually recursive functions.
+func TestRemoveUnreachableCycle(t *testing.T) {
+	s := `
+def main(): call a(); send x;
+def a(): recv x;
+def b(): call c(); send y;
+def c(): call b(); recv y;
+def d(): call d();
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	mainfn, found := prog.Function("main")
+	if !found {
+		t.Fatal("main function not found")
+	}
+	if err := Remove(prog, mainfn); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 5, len(prog.Funcs); want != got {
+		t.Errorf("expects %d functions (cycles not removed) but got %d", want, got)
+	}
+	removed, err := RemoveUnreachable(prog, mainfn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(prog.Funcs); want != got {
+		t.Errorf("expects %d functions after removing {b,c,d} but got %d:\n%s", want, got, prog)
+	}
+	if want, got := 3, len(removed); want != got {
+		t.Fatalf("expects %d removed functions but got %d", want, got)
+	}
+	for i, name := range []string{"b", "c", "d"} {
+		if want, got := name, removed[i].Func.Name; want != got {
+			t.Errorf("removed[%d]: expects %s removed but got %s", i, want, got)
+		}
+	}
+	if want, got := "only called by unreachable functions {c}", removed[0].Reason; want != got {
+		t.Errorf("expects reason %q but got %q", want, got)
+	}
+}
+
+// Tests removal with multiple entries.
+func TestRemoveUnreachableEntries(t *testing.T) {
+	s := `
+def TestA(): call a();
+def TestB(): spawn b();
+def a(): send x;
+def b(): recv x;
+def c(): tau;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	testA, _ := prog.Function("TestA")
+	testB, _ := prog.Function("TestB")
+	removed, err := RemoveUnreachable(prog, testA, testB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(removed); want != got {
+		t.Fatalf("expects %d removed functions but got %d", want, got)
+	}
+	if want, got := "c: not called by any function and unreachable from {TestA, TestB}", removed[0].String(); want != got {
+		t.Errorf("expects %q but got %q", want, got)
+	}
+}
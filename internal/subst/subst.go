@@ -0,0 +1,327 @@
+// Package subst defines substitution of names in MiGo statements.
+//
+// Names in MiGo statements are either bound by a declaration, i.e.
+// let (newchan), letmem or letsync, or free (function parameters and
+// globals). A declaration binds its name for the rest of the enclosing
+// statement sequence, including nested statements.
+//
+// Stmts copies statements replacing free names, and renames bound names
+// on the way if required, so substitution never captures a free name.
+package subst
+
+import (
+	"github.com/nickng/migo/v3"
+)
+
+// Var is a plain migo.NamedVar.
+type Var string
+
+// Name returns the name of the variable.
+func (v Var) Name() string { return string(v) }
+
+func (v Var) String() string { return string(v) }
+
+// Stmts returns a copy of stmts with every free name x in env replaced
+// by env[x]. Free names not in env are unchanged.
+//
+// Each name x bound in stmts by declaration decl is renamed to
+// bind(x, decl) within its scope. If bind is nil, bound names are unchanged.
+//
+// An *migo.ErrUnknownStatement is returned if stmts contains a statement
+// not defined in the migo package, including a migo.CustomStatement, as
+// its names cannot be substituted.
+func Stmts(stmts []migo.Statement, env map[string]string, bind func(name string, decl migo.Statement) string) ([]migo.Statement, error) {
+	s := &substituter{bind: bind}
+	return s.stmts(stmts, env)
+}
+
+type substituter struct {
+	bind func(name string, decl migo.Statement) string
+}
+
+// name returns the substitution of name x in env.
+func name(env map[string]string, x string) string {
+	if y, ok := env[x]; ok {
+		return y
+	}
+	return x
+}
+
+// binder returns the new name of bound name x, and env extended with it.
+// env is copied before extended, so it can be shared by other scopes.
+func (s *substituter) binder(env map[string]string, x string, decl migo.Statement) (string, map[string]string) {
+	y := x
+	if s.bind != nil {
+		y = s.bind(x, decl)
+	}
+	if y == name(env, x) {
+		return y, env
+	}
+	ext := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		ext[k] = v
+	}
+	ext[x] = y
+	return y, ext
+}
+
+func (s *substituter) params(params []*migo.Parameter, env map[string]string) []*migo.Parameter {
+	ps := make([]*migo.Parameter, len(params))
+	for i, p := range params {
+		ps[i] = &migo.Parameter{Caller: Var(name(env, p.Caller.Name())), Callee: p.Callee}
+	}
+	return ps
+}
+
+func (s *substituter) stmts(stmts []migo.Statement, env map[string]string) ([]migo.Statement, error) {
+	if stmts == nil {
+		return nil, nil
+	}
+	ss := make([]migo.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		var err error
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			var x string
+			x, env = s.binder(env, stmt.Name.Name(), stmt)
+			ss = append(ss, &migo.NewChanStatement{Name: Var(x), Chan: stmt.Chan, Size: stmt.Size})
+		case *migo.NewMem:
+			var x string
+			x, env = s.binder(env, stmt.Name, stmt)
+			ss = append(ss, &migo.NewMem{Name: x})
+		case *migo.NewSyncMutex:
+			var x string
+			x, env = s.binder(env, stmt.Name, stmt)
+			ss = append(ss, &migo.NewSyncMutex{Name: x})
+		case *migo.NewSyncRWMutex:
+			var x string
+			x, env = s.binder(env, stmt.Name, stmt)
+			ss = append(ss, &migo.NewSyncRWMutex{Name: x})
+		case *migo.SendStatement:
+			ss = append(ss, &migo.SendStatement{Chan: name(env, stmt.Chan)})
+		case *migo.RecvStatement:
+			ss = append(ss, &migo.RecvStatement{Chan: name(env, stmt.Chan)})
+		case *migo.CloseStatement:
+			ss = append(ss, &migo.CloseStatement{Chan: name(env, stmt.Chan)})
+		case *migo.MemRead:
+			ss = append(ss, &migo.MemRead{Name: name(env, stmt.Name)})
+		case *migo.MemWrite:
+			ss = append(ss, &migo.MemWrite{Name: name(env, stmt.Name)})
+		case *migo.SyncMutexLock:
+			ss = append(ss, &migo.SyncMutexLock{Name: name(env, stmt.Name)})
+		case *migo.SyncMutexUnlock:
+			ss = append(ss, &migo.SyncMutexUnlock{Name: name(env, stmt.Name)})
+		case *migo.SyncRWMutexRLock:
+			ss = append(ss, &migo.SyncRWMutexRLock{Name: name(env, stmt.Name)})
+		case *migo.SyncRWMutexRUnlock:
+			ss = append(ss, &migo.SyncRWMutexRUnlock{Name: name(env, stmt.Name)})
+		case *migo.SyncRWMutexLock:
+			ss = append(ss, &migo.SyncRWMutexLock{Name: name(env, stmt.Name)})
+		case *migo.SyncRWMutexUnlock:
+			ss = append(ss, &migo.SyncRWMutexUnlock{Name: name(env, stmt.Name)})
+		case *migo.TauStatement:
+			ss = append(ss, &migo.TauStatement{})
+		case *migo.CallStatement:
+			ss = append(ss, &migo.CallStatement{Name: stmt.Name, Params: s.params(stmt.Params, env)})
+		case *migo.SpawnStatement:
+			ss = append(ss, &migo.SpawnStatement{Name: stmt.Name, Params: s.params(stmt.Params, env)})
+		case *migo.IfStatement:
+			st := new(migo.IfStatement)
+			if st.Then, err = s.stmts(stmt.Then, env); err != nil {
+				return nil, err
+			}
+			if st.Else, err = s.stmts(stmt.Else, env); err != nil {
+				return nil, err
+			}
+			ss = append(ss, st)
+		case *migo.IfForStatement:
+			st := &migo.IfForStatement{ForCond: stmt.ForCond}
+			if st.Then, err = s.stmts(stmt.Then, env); err != nil {
+				return nil, err
+			}
+			if st.Else, err = s.stmts(stmt.Else, env); err != nil {
+				return nil, err
+			}
+			ss = append(ss, st)
+		case *migo.SelectStatement:
+			st := &migo.SelectStatement{Cases: make([][]migo.Statement, len(stmt.Cases))}
+			for i, c := range stmt.Cases {
+				if st.Cases[i], err = s.stmts(c, env); err != nil {
+					return nil, err
+				}
+			}
+			ss = append(ss, st)
+		default:
+			return nil, &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+	}
+	return ss, nil
+}
+
+// Names returns the set of all names in stmts, free or bound.
+// Names in a migo.CustomStatement are not included.
+func Names(stmts []migo.Statement) map[string]bool {
+	names := make(map[string]bool)
+	addNames(names, stmts)
+	return names
+}
+
+func addNames(names map[string]bool, stmts []migo.Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			names[stmt.Name.Name()] = true
+		case *migo.NewMem:
+			names[stmt.Name] = true
+		case *migo.NewSyncMutex:
+			names[stmt.Name] = true
+		case *migo.NewSyncRWMutex:
+			names[stmt.Name] = true
+		case *migo.SendStatement:
+			names[stmt.Chan] = true
+		case *migo.RecvStatement:
+			names[stmt.Chan] = true
+		case *migo.CloseStatement:
+			names[stmt.Chan] = true
+		case *migo.MemRead:
+			names[stmt.Name] = true
+		case *migo.MemWrite:
+			names[stmt.Name] = true
+		case *migo.SyncMutexLock:
+			names[stmt.Name] = true
+		case *migo.SyncMutexUnlock:
+			names[stmt.Name] = true
+		case *migo.SyncRWMutexRLock:
+			names[stmt.Name] = true
+		case *migo.SyncRWMutexRUnlock:
+			names[stmt.Name] = true
+		case *migo.SyncRWMutexLock:
+			names[stmt.Name] = true
+		case *migo.SyncRWMutexUnlock:
+			names[stmt.Name] = true
+		case *migo.CallStatement:
+			for _, p := range stmt.Params {
+				names[p.Caller.Name()] = true
+			}
+		case *migo.SpawnStatement:
+			for _, p := range stmt.Params {
+				names[p.Caller.Name()] = true
+			}
+		case *migo.IfStatement:
+			addNames(names, stmt.Then)
+			addNames(names, stmt.Else)
+		case *migo.IfForStatement:
+			addNames(names, stmt.Then)
+			addNames(names, stmt.Else)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				addNames(names, c)
+			}
+		}
+	}
+}
+
+// Free returns the set of free names in stmts, i.e. names not bound by
+// a declaration in stmts. Names in a migo.CustomStatement are not included.
+func Free(stmts []migo.Statement) map[string]bool {
+	free := make(map[string]bool)
+	addFree(free, stmts, nil)
+	return free
+}
+
+func addFree(free map[string]bool, stmts []migo.Statement, bound map[string]bool) {
+	use := func(name string) {
+		if !bound[name] {
+			free[name] = true
+		}
+	}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement, *migo.NewMem, *migo.NewSyncMutex, *migo.NewSyncRWMutex:
+			ext := map[string]bool{Declared(stmt): true}
+			for k := range bound {
+				ext[k] = true
+			}
+			bound = ext
+		case *migo.IfStatement:
+			addFree(free, stmt.Then, bound)
+			addFree(free, stmt.Else, bound)
+		case *migo.IfForStatement:
+			addFree(free, stmt.Then, bound)
+			addFree(free, stmt.Else, bound)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				addFree(free, c, bound)
+			}
+		case migo.CustomStatement:
+		default:
+			for name := range Names([]migo.Statement{stmt}) {
+				use(name)
+			}
+		}
+	}
+}
+
+// Declared returns the name declared by stmt,
+// or empty string if stmt is not a declaration.
+func Declared(stmt migo.Statement) string {
+	switch stmt := stmt.(type) {
+	case *migo.NewChanStatement:
+		return stmt.Name.Name()
+	case *migo.NewMem:
+		return stmt.Name
+	case *migo.NewSyncMutex:
+		return stmt.Name
+	case *migo.NewSyncRWMutex:
+		return stmt.Name
+	}
+	return ""
+}
+
+// Size returns the number of statements in stmts, including nested ones.
+func Size(stmts []migo.Statement) int {
+	n := 0
+	for _, stmt := range stmts {
+		n++
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			n += Size(stmt.Then) + Size(stmt.Else)
+		case *migo.IfForStatement:
+			n += Size(stmt.Then) + Size(stmt.Else)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				n += Size(c)
+			}
+		case migo.CustomStatement:
+			for _, c := range stmt.Children() {
+				n += Size(c)
+			}
+		}
+	}
+	return n
+}
+
+// Walk calls visit for each statement in stmts in order, including nested
+// statements and the children of a migo.CustomStatement, visiting a
+// statement before its nested statements.
+func Walk(stmts []migo.Statement, visit func(stmt migo.Statement)) {
+	for _, stmt := range stmts {
+		visit(stmt)
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			Walk(stmt.Then, visit)
+			Walk(stmt.Else, visit)
+		case *migo.IfForStatement:
+			Walk(stmt.Then, visit)
+			Walk(stmt.Else, visit)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				Walk(c, visit)
+			}
+		case migo.CustomStatement:
+			for _, c := range stmt.Children() {
+				Walk(c, visit)
+			}
+		}
+	}
+}
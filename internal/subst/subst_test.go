@@ -0,0 +1,40 @@
+package subst
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/parser"
+)
+
+// Tests substitution of free names and renaming of bound names.
+func TestStmts(t *testing.T) {
+	s := `def main(a): send a; let b = newchan b, 0; send b; if recv a; else letmem a; read a; endif; close a;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	fn := prog.Funcs[0]
+	stmts, err := Stmts(fn.Stmts, map[string]string{"a": "x", "b": "y"}, func(name string, _ migo.Statement) string { return name + "'" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, stmt := range stmts {
+		got = append(got, stmt.String())
+	}
+	if want := "send x; let b' = newchan b, 0; send b'; if recv x; else letmem a'; read a'; endif; close x"; want != strings.Join(got, "; ") {
+		t.Errorf("unexpected substitution, want:\n%s\ngot:\n%s", want, strings.Join(got, "; "))
+	}
+	if want, got := "send a", fn.Stmts[0].String(); want != got {
+		t.Errorf("expects original statements unchanged, want %s but got %s", want, got)
+	}
+	if want, got := 8, Size(fn.Stmts); want != got {
+		t.Errorf("expects size %d but got %d", want, got)
+	}
+	if want, got := 2, len(Names(fn.Stmts)); want != got {
+		t.Errorf("expects %d names but got %d: %v", want, got, Names(fn.Stmts))
+	}
+}
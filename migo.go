@@ -192,6 +192,23 @@ func (f *Function) SimpleName() string {
 	return nameFilter.Replace(f.Name)
 }
 
+// FreshName returns a fresh variable name in the function, which is prefix
+// followed by the next fresh variable index of the function, e.g. t0, t1.
+// The index starts from 0 and is shared by all prefixes.
+//
+// FreshName does not check the names already used in the function.
+func (f *Function) FreshName(prefix string) string {
+	name := fmt.Sprintf("%s%d", prefix, f.varIdx)
+	f.varIdx++
+	return name
+}
+
+// ResetFreshNames resets the fresh variable index of the function,
+// so FreshName starts from 0 again, e.g. to rename all variables.
+func (f *Function) ResetFreshNames() {
+	f.varIdx = 0
+}
+
 // AddStmts add Statement(s) to a Function.
 func (f *Function) AddStmts(stmts ...Statement) {
 	numStmts := len(f.Stmts)
@@ -257,6 +274,34 @@ type Statement interface {
 	String() string
 }
 
+// CustomStatement is a Statement defined outside of this package.
+//
+// Analyses and transformations of MiGo programs use the methods of
+// CustomStatement to handle statements they do not otherwise know about.
+// Statements not defined in this package that do not implement
+// CustomStatement are rejected with an ErrUnknownStatement.
+type CustomStatement interface {
+	Statement
+
+	// Children returns the nested blocks of statements of the statement,
+	// e.g. branches of a conditional, which are executed after it.
+	Children() [][]Statement
+
+	// IsTau returns true if the statement itself (i.e. excluding Children)
+	// does not have observable effect, i.e. it can be reduced to τ.
+	IsTau() bool
+}
+
+// ErrUnknownStatement is the error for statements
+// not known to an analysis or transformation.
+type ErrUnknownStatement struct {
+	Stmt Statement
+}
+
+func (e *ErrUnknownStatement) Error() string {
+	return fmt.Sprintf("statement kind not found: %T", e.Stmt)
+}
+
 // CallStatement captures function calls or block jumps in the SSA.
 type CallStatement struct {
 	Name   string
@@ -512,3 +557,21 @@ type SyncRWMutexRUnlock struct {
 func (m *SyncRWMutexRUnlock) String() string {
 	return fmt.Sprintf("runlock %s", nameFilter.Replace(m.Name))
 }
+
+// SyncRWMutexLock is a sync.RWMutex Lock (writer lock) statement.
+type SyncRWMutexLock struct {
+	Name string
+}
+
+func (m *SyncRWMutexLock) String() string {
+	return fmt.Sprintf("lock %s", nameFilter.Replace(m.Name))
+}
+
+// SyncRWMutexUnlock is a sync.RWMutex Unlock (writer unlock) statement.
+type SyncRWMutexUnlock struct {
+	Name string
+}
+
+func (m *SyncRWMutexUnlock) String() string {
+	return fmt.Sprintf("unlock %s", nameFilter.Replace(m.Name))
+}
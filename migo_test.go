@@ -81,3 +81,21 @@ func TestLockSyntax(t *testing.T) {
 		t.Errorf("syntax mismatch, want:\n%s\ngot:\n%s", want, got)
 	}
 }
+
+// Tests fresh variable name generation.
+func TestFreshName(t *testing.T) {
+	fn := migo.NewFunction("main")
+	for i, want := range []string{"t0", "t1", "ch2"} {
+		prefix := "t"
+		if i == 2 {
+			prefix = "ch"
+		}
+		if got := fn.FreshName(prefix); want != got {
+			t.Errorf("expects fresh name %s but got %s", want, got)
+		}
+	}
+	fn.ResetFreshNames()
+	if want, got := "t0", fn.FreshName("t"); want != got {
+		t.Errorf("expects fresh name %s after reset but got %s", want, got)
+	}
+}
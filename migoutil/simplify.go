@@ -1,24 +1,127 @@
 package migoutil
 
 import (
-	"github.com/nickng/migo/internal/passes/unused"
+	"regexp"
+	"strings"
+
 	"github.com/nickng/migo/v3"
-	"github.com/nickng/migo/v3/internal/passes/deadcall"
-	"github.com/nickng/migo/v3/internal/passes/taufunc"
+	"github.com/nickng/migo/v3/passes"
 )
 
+// Options is the options for simplifying a Program.
+type Options struct {
+	// Entries are the names of the entry functions of the program.
+	// A name may contain * which matches any sequence of characters,
+	// e.g. "*.Test*" for all tests.
+	//
+	// Functions not reachable from entries are removed. If none of the
+	// entries is defined in the program, all functions are kept.
+	Entries []string
+
+	// KeepEntries keeps the entry functions even if they reduce to τ.
+	KeepEntries bool
+
+	// Fixpoint repeats the simplification passes until the program stops
+	// changing, as removing statements in one pass can make more functions
+	// removable in another, or until MaxIterations is reached.
+	Fixpoint bool
+
+	// MaxIterations is the maximum number of iterations in Fixpoint mode.
+	// passes.DefaultMaxIterations is used if MaxIterations is not positive.
+	MaxIterations int
+
+	// Fragment is the fragments of the language to keep, e.g.
+	// passes.ChanFragment for checkers which only support channels.
+	// Primitives of other fragments are replaced by τ and simplified away,
+	// including declarations and parameters no longer used.
+	// If Fragment is 0, all fragments are kept.
+	Fragment passes.Fragment
+
+	// Channels are the names of the channels to slice the program with
+	// respect to, e.g. to debug a deadlock on a channel. The name of a
+	// channel is its declared name or label in a newchan statement.
+	// All statements not needed for the operations on the channels are
+	// simplified away. If Channels is empty, the program is not sliced.
+	Channels []string
+}
+
+// DefaultOptions returns the Options of SimplifyProgram, i.e.
+// simplification with respect to "main".main.
+func DefaultOptions() *Options {
+	return &Options{Entries: []string{`"main".main`}, KeepEntries: true}
+}
+
 // SimplifyProgram takes the input Program prog and reduce it
 // to a smaller equivalent Program.
 //
-// It removes functions that reduces to τ, and
-// removes call to functions that do not exist.
-func SimplifyProgram(prog *migo.Program) *migo.Program {
-	if mainmain, hasMM := prog.Function(`"main".main`); hasMM {
-		taufunc.Find(prog, taufunc.RemoveExcept(mainmain))
-		unused.Remove(prog, mainmain)
-	} else {
-		taufunc.Find(prog, taufunc.Remove)
-	}
-	deadcall.Remove(prog)
-	return prog
+// It removes functions that reduces to τ, functions that are unreachable
+// from "main".main, and removes call to functions that do not exist, with
+// the conditionals, loops (ifFor) and selects reduced to τ by the removal.
+//
+// An error is returned if prog contains statements
+// that cannot be handled by the simplification passes.
+func SimplifyProgram(prog *migo.Program) (*migo.Program, error) {
+	if _, err := Simplify(prog, DefaultOptions()); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// Simplify reduces Program prog in place to a smaller equivalent Program
+// with the given Options, and returns a report of every function and
+// statement removed by each simplification pass.
+//
+// If opts is nil, DefaultOptions is used.
+func Simplify(prog *migo.Program, opts *Options) (*passes.Report, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	entries := matchFuncs(prog, opts.Entries)
+	var keep []string
+	if opts.KeepEntries {
+		keep = entries
+	}
+	pl := passes.NewPipeline(
+		passes.TauFunc(keep...),
+		passes.Unused(entries...),
+		passes.DeadCall())
+	var reduce []passes.Pass
+	if opts.Fragment != 0 && opts.Fragment != passes.AllFragments {
+		reduce = append(reduce, passes.Project(opts.Fragment))
+	}
+	if len(opts.Channels) > 0 {
+		reduce = append(reduce, passes.Slice(opts.Channels...))
+	}
+	if len(reduce) > 0 {
+		pl.Passes = append(append(reduce,
+			passes.Peephole(),
+			passes.DeadParam(entries...),
+			passes.DeadRes()), pl.Passes...)
+	}
+	pl.Fixpoint = opts.Fixpoint
+	pl.MaxIterations = opts.MaxIterations
+	return pl.Run(prog)
+}
+
+// matchFuncs returns the names of the functions in prog matching patterns,
+// where * in a pattern matches any sequence of characters.
+func matchFuncs(prog *migo.Program, patterns []string) []string {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		parts := strings.Split(pattern, "*")
+		for j := range parts {
+			parts[j] = regexp.QuoteMeta(parts[j])
+		}
+		res[i] = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+	}
+	var names []string
+	for _, fn := range prog.Funcs {
+		for _, re := range res {
+			if re.MatchString(fn.Name) {
+				names = append(names, fn.Name)
+				break
+			}
+		}
+	}
+	return names
 }
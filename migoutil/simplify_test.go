@@ -1,13 +1,18 @@
 package migoutil_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/nickng/migo/v3"
 	"github.com/nickng/migo/v3/migoutil"
 	"github.com/nickng/migo/v3/parser"
+	"github.com/nickng/migo/v3/passes"
 )
 
 // ErrFuncNotExists is Error if function does not exist in program which is
@@ -111,7 +116,9 @@ func TestSimplifyProgram(t *testing.T) {
 			t.Error(&ErrFuncNotExist{f: exist})
 		}
 	}
-	migoutil.SimplifyProgram(p)
+	if _, err := migoutil.SimplifyProgram(p); err != nil {
+		t.Fatal(err)
+	}
 	if len(p.Funcs) != 3 {
 		t.Errorf("Expects 3 functions in program, but got %d", len(p.Funcs))
 	}
@@ -147,7 +154,9 @@ def work(): tau;
 		t.Error(err)
 		t.FailNow()
 	}
-	migoutil.SimplifyProgram(prog)
+	if _, err := migoutil.SimplifyProgram(prog); err != nil {
+		t.Fatal(err)
+	}
 	if len(prog.Funcs) != 3 {
 		t.Errorf("Expects 3 functions in program, but got %d", len(prog.Funcs))
 	}
@@ -254,7 +263,9 @@ func TestSimplifyProgram2(t *testing.T) {
 			t.Error(&ErrFuncNotExist{f: exist})
 		}
 	}
-	migoutil.SimplifyProgram(p)
+	if _, err := migoutil.SimplifyProgram(p); err != nil {
+		t.Fatal(err)
+	}
 	if len(p.Funcs) != 4 {
 		t.Errorf("Expects 4 functions in program, but got %d", len(p.Funcs))
 	}
@@ -293,7 +304,9 @@ def work$3(ch):
 		t.Error(err)
 		t.FailNow()
 	}
-	migoutil.SimplifyProgram(prog)
+	if _, err := migoutil.SimplifyProgram(prog); err != nil {
+		t.Fatal(err)
+	}
 	if len(prog.Funcs) != 4 {
 		t.Errorf("Expects 4 functions in program, but got %d", len(prog.Funcs))
 	}
@@ -341,9 +354,11 @@ def main.wait#1(x):
     call main.wait#1(x);`
 	r := strings.NewReader(s)
 	parsed, err := parser.Parse(r)
-	migoutil.SimplifyProgram(parsed)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if _, err := migoutil.SimplifyProgram(parsed); err != nil {
+		t.Fatal(err)
 	}
 	if strings.TrimSpace(parsed.String()) != expect {
 		t.Errorf("Expects main.xx#2 calls to be removed\n--- expect ---\n%s\n--- got ---\n%s\n",
@@ -354,7 +369,9 @@ def main.wait#1(x):
 		t.Error(err)
 		t.FailNow()
 	}
-	migoutil.SimplifyProgram(prog)
+	if _, err := migoutil.SimplifyProgram(prog); err != nil {
+		t.Fatal(err)
+	}
 	if strings.TrimSpace(prog.String()) != expect {
 		t.Errorf("Expects main.xx#2 calls to be removed\n--- expect ---\n%s\n--- got ---\n%s\n",
 			expect, prog.String())
@@ -423,7 +440,9 @@ func TestSimplfyProgramMemOp(t *testing.T) {
 			t.Error(&ErrFuncNotExist{f: exist})
 		}
 	}
-	migoutil.SimplifyProgram(p)
+	if _, err := migoutil.SimplifyProgram(p); err != nil {
+		t.Fatal(err)
+	}
 	if len(p.Funcs) != 4 {
 		t.Errorf("Expects 4 functions in program, but got %d", len(p.Funcs))
 	}
@@ -459,7 +478,9 @@ def work(): tau;
 		t.Error(err)
 		t.FailNow()
 	}
-	migoutil.SimplifyProgram(prog)
+	if _, err := migoutil.SimplifyProgram(prog); err != nil {
+		t.Fatal(err)
+	}
 	if len(prog.Funcs) != 3 {
 		t.Errorf("Expects 3 functions in program, but got %d", len(prog.Funcs))
 	}
@@ -476,3 +497,337 @@ def work(): tau;
 		}
 	}
 }
+
+// Tests SimplifyProgram removes unreachable (mutually recursive) functions.
+func TestSimplifyProgramUnreachableCycle(t *testing.T) {
+	s := `
+def main(): call a(); send x;
+def a(): recv x;
+def b(): call c(); send y;
+def c(): call b(); recv y;
+	`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	prog.Funcs[0].Name = `"main".main`
+	if _, err := migoutil.SimplifyProgram(prog); err != nil {
+		t.Fatal(err)
+	}
+	if len(prog.Funcs) != 2 {
+		t.Errorf("Expects 2 functions in program, but got %d", len(prog.Funcs))
+	}
+	// These should remain
+	for _, remain := range []string{`"main".main`, "a"} {
+		if _, ok := prog.Function(remain); !ok {
+			t.Error(&ErrFuncNotExist{f: remain})
+		}
+	}
+	// These should be removed
+	for _, removed := range []string{"b", "c"} {
+		if _, ok := prog.Function(removed); ok {
+			t.Error(&ErrFuncExist{f: removed})
+		}
+	}
+}
+
+// Tests SimplifyProgram removes conditionals, loops and selects which
+// reduce to τ after removing dead calls, without Fixpoint.
+func TestSimplifyProgramTauBlocks(t *testing.T) {
+	s := `
+def main():
+    send x;
+    if call missing(); else tau; endif;
+    select case tau; call missing(); case tau; endselect;
+    recv x;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFunc := prog.Funcs[0]
+	mainFunc.Name = `"main".main`
+	mainFunc.Stmts = append(mainFunc.Stmts[:3:3], &migo.IfForStatement{
+		ForCond: "i",
+		Then:    []migo.Statement{&migo.CallStatement{Name: "missing"}},
+		Else:    []migo.Statement{&migo.TauStatement{}},
+	}, mainFunc.Stmts[3])
+	if _, err := migoutil.SimplifyProgram(prog); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `def main.main():
+    send x;
+    recv x;
+`, prog.String(); want != got {
+		t.Errorf("Unexpected simplified program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// loopStmt is a custom statement which repeats its body.
+type loopStmt struct {
+	body []migo.Statement
+}
+
+func (s *loopStmt) String() string               { return "loop" }
+func (s *loopStmt) Children() [][]migo.Statement { return [][]migo.Statement{s.body} }
+func (s *loopStmt) IsTau() bool                  { return true }
+
+// blockString returns the statements of block separated by "; ".
+func blockString(block []migo.Statement) string {
+	stmts := make([]string, len(block))
+	for i, stmt := range block {
+		stmts[i] = stmt.String()
+	}
+	return strings.Join(stmts, "; ")
+}
+
+// unknownStmt is a statement unknown to the simplification passes.
+type unknownStmt struct{}
+
+func (s *unknownStmt) String() string { return "unknown" }
+
+// Tests SimplifyProgram in the presence of custom statements.
+func TestSimplifyProgramCustomStmt(t *testing.T) {
+	p := migo.NewProgram()
+	mainFunc := migo.NewFunction(`"main".main`)
+	mainFunc.AddStmts(&loopStmt{body: []migo.Statement{
+		&migo.CallStatement{Name: "send"},
+		&migo.CallStatement{Name: "work"},
+	}})
+	sendFunc := migo.NewFunction("send")
+	sendFunc.AddStmts(&loopStmt{body: []migo.Statement{&migo.SendStatement{Chan: "x"}}})
+	workFunc := migo.NewFunction("work")
+	workFunc.AddStmts(&loopStmt{body: []migo.Statement{&migo.TauStatement{}}})
+	p.AddFunction(mainFunc)
+	p.AddFunction(sendFunc)
+	p.AddFunction(workFunc)
+
+	if _, err := migoutil.SimplifyProgram(p); err != nil {
+		t.Fatal(err)
+	}
+	// These should remain
+	for _, remain := range []string{`"main".main`, "send"} {
+		if _, ok := p.Function(remain); !ok {
+			t.Error(&ErrFuncNotExist{f: remain})
+		}
+	}
+	// These should be removed
+	for _, removed := range []string{"work"} {
+		if _, ok := p.Function(removed); ok {
+			t.Error(&ErrFuncExist{f: removed})
+		}
+	}
+	// Calls to removed functions in custom statements are replaced by τ
+	if want, got := "call send(); tau", blockString(mainFunc.Stmts[0].(*loopStmt).body); want != got {
+		t.Errorf("Expects loop body %q, but got %q", want, got)
+	}
+
+	workFunc.AddStmts(&unknownStmt{})
+	p.AddFunction(workFunc)
+	_, err := migoutil.SimplifyProgram(p)
+	var unknownErr *migo.ErrUnknownStatement
+	if !errors.As(err, &unknownErr) {
+		t.Errorf("Expects unknown statement error, but got %v", err)
+	}
+}
+
+// Tests Simplify with test functions as entries.
+func TestSimplifyEntries(t *testing.T) {
+	s := `
+def pkg.TestA(): call pkg.helper(); call pkg.noop();
+def pkg.TestB(): tau;
+def pkg.helper(): send x; call pkg.missing();
+def pkg.noop(): tau;
+def pkg.internal(): recv x;
+	`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := migoutil.Simplify(prog, &migoutil.Options{Entries: []string{"pkg.Test*"}, KeepEntries: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// These should remain
+	for _, remain := range []string{"pkg.TestA", "pkg.TestB", "pkg.helper"} {
+		if _, ok := prog.Function(remain); !ok {
+			t.Error(&ErrFuncNotExist{f: remain})
+		}
+	}
+	// These should be removed
+	for _, removed := range []string{"pkg.noop", "pkg.internal"} {
+		if _, ok := prog.Function(removed); ok {
+			t.Error(&ErrFuncExist{f: removed})
+		}
+	}
+	removed := report.Removed()
+	want := []string{
+		"def pkg.noop: reduces to τ",
+		"def pkg.internal: not called by any function and unreachable from {pkg.TestA, pkg.TestB}",
+		"call pkg.noop() in def pkg.TestA: function pkg.noop is removed or not defined",
+		"call pkg.missing() in def pkg.helper: function pkg.missing is removed or not defined",
+	}
+	if len(want) != len(removed) {
+		t.Fatalf("Expects %d removals, but got %d:\n%s", len(want), len(removed), report)
+	}
+	for i := range want {
+		if got := removed[i].String(); want[i] != got {
+			t.Errorf("Expects removal %q, but got %q", want[i], got)
+		}
+	}
+
+	// Without keeping entries, τ entry pkg.TestB is removed.
+	prog, _ = parser.Parse(strings.NewReader(s))
+	if _, err := migoutil.Simplify(prog, &migoutil.Options{Entries: []string{"pkg.Test*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := prog.Function("pkg.TestB"); ok {
+		t.Error(&ErrFuncExist{f: "pkg.TestB"})
+	}
+}
+
+// Tests Simplify in fixpoint mode against the corpus in testdata/fixpoint.
+//
+// Each NAME.migo is simplified with respect to main, and the result must
+// match NAME.golden and be strictly smaller than simplifying once.
+func TestSimplifyFixpoint(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "fixpoint", "*.migo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expects test corpus in testdata/fixpoint, but found none")
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := ioutil.ReadFile(strings.TrimSuffix(file, ".migo") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		once, err := parser.Parse(bytes.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if _, err := migoutil.Simplify(once, &migoutil.Options{Entries: []string{"main"}, KeepEntries: true}); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		fixed, err := parser.Parse(bytes.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		report, err := migoutil.Simplify(fixed, &migoutil.Options{Entries: []string{"main"}, KeepEntries: true, Fixpoint: true})
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !report.Converged {
+			t.Errorf("%s: Expects simplification to converge, but stopped after %d iterations", file, report.Iterations)
+		}
+		if want, got := string(golden), fixed.String(); want != got {
+			t.Errorf("%s: Unexpected fixpoint result, want:\n%sgot:\n%s", file, want, got)
+		}
+		if len(fixed.String()) >= len(once.String()) {
+			t.Errorf("%s: Expects fixpoint result to be smaller than\n%sbut got:\n%s", file, once, fixed)
+		}
+	}
+}
+
+// Tests Simplify projecting the program onto fragments of the language.
+func TestSimplifyFragment(t *testing.T) {
+	s := `
+def main():
+	let c = newchan c, 0;
+	letmem m;
+	letsync l mutex;
+	spawn worker(c, m, l);
+	lock l;
+	write m;
+	unlock l;
+	recv c;
+def worker(ch, mem, mu):
+	lock mu;
+	read mem;
+	unlock mu;
+	send ch;
+def logger(mem):
+	read mem;
+`
+	tests := []struct {
+		fragment passes.Fragment
+		want     string
+	}{
+		{passes.ChanFragment, `def main():
+    let c = newchan c, 0;
+    spawn worker(c);
+    recv c;
+def worker(ch):
+    send ch;
+`},
+		{passes.MemFragment | passes.MutexFragment, `def main():
+    letmem m;
+    letsync l mutex;
+    spawn worker(m, l);
+    lock l;
+    write m;
+    unlock l;
+def worker(mem, mu):
+    lock mu;
+    read mem;
+    unlock mu;
+`},
+	}
+	for _, test := range tests {
+		prog, err := parser.Parse(strings.NewReader(s))
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		opts := &migoutil.Options{Entries: []string{"main"}, KeepEntries: true, Fixpoint: true, Fragment: test.fragment}
+		if _, err := migoutil.Simplify(prog, opts); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := test.want, prog.String(); want != got {
+			t.Errorf("%s: unexpected projection, want:\n%sgot:\n%s", test.fragment, want, got)
+		}
+	}
+}
+
+// Tests Simplify slicing the program with respect to a channel.
+func TestSimplifyChannels(t *testing.T) {
+	s := `
+def main():
+	let a = newchan main.a, 0;
+	let b = newchan main.b, 1;
+	spawn f(a, b);
+	call g(b);
+	select case recv a; send b; case recv b; endselect;
+def f(x, y): send x; send y; call h();
+def g(z): recv z;
+def h(): letmem m; write m;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	opts := &migoutil.Options{Entries: []string{"main"}, KeepEntries: true, Fixpoint: true, Channels: []string{"a"}}
+	if _, err := migoutil.Simplify(prog, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `def main():
+    let a = newchan main.a, 0;
+    spawn f(a);
+    select
+      case recv a;
+      case tau;
+    endselect;
+def f(x):
+    send x;
+`, prog.String(); want != got {
+		t.Errorf("unexpected slice, want:\n%sgot:\n%s", want, got)
+	}
+}
@@ -101,6 +101,7 @@ func Parse(r io.Reader) (*migo.Program, error) {
 	case err := <-l.Errors:
 		return nil, err
 	default:
+		resolveRWMutex(prog)
 		return prog, nil
 	}
 }
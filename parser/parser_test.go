@@ -128,7 +128,7 @@ func TestParseRWMutex(t *testing.T) {
 	if stmt0.Name != "a" {
 		t.Errorf("expected letsync a rwmutex but got %v", fn.Stmts[0])
 	}
-	stmt1, ok := fn.Stmts[1].(*migo.SyncMutexLock)
+	stmt1, ok := fn.Stmts[1].(*migo.SyncRWMutexLock)
 	if !ok {
 		t.Errorf("expecting lock statement but got %v", fn.Stmts[1])
 		t.FailNow()
@@ -136,7 +136,7 @@ func TestParseRWMutex(t *testing.T) {
 	if stmt1.Name != "a" {
 		t.Errorf("expected lock a but got %v", fn.Stmts[1])
 	}
-	stmt2, ok := fn.Stmts[2].(*migo.SyncMutexUnlock)
+	stmt2, ok := fn.Stmts[2].(*migo.SyncRWMutexUnlock)
 	if !ok {
 		t.Errorf("expecting unlock statement but got %v", fn.Stmts[2])
 		t.FailNow()
@@ -161,3 +161,53 @@ func TestParseRWMutex(t *testing.T) {
 		t.Errorf("expected runlock a but got %v", fn.Stmts[4])
 	}
 }
+
+// Lock and unlock of rwmutexes passed as parameters are writer locks.
+func TestParseRWMutexParam(t *testing.T) {
+	s := `def main(): letsync a rwmutex; letsync b mutex; call f(a, b);
+def f(x, y): lock x; lock y; unlock y; unlock x;`
+	parsed, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	fn, found := parsed.Function("f")
+	if !found {
+		t.Error("cannot find f function")
+		t.FailNow()
+	}
+	if _, ok := fn.Stmts[0].(*migo.SyncRWMutexLock); !ok {
+		t.Errorf("expecting rwmutex lock statement but got %v", fn.Stmts[0])
+	}
+	if _, ok := fn.Stmts[1].(*migo.SyncMutexLock); !ok {
+		t.Errorf("expecting mutex lock statement but got %v", fn.Stmts[1])
+	}
+	if _, ok := fn.Stmts[2].(*migo.SyncMutexUnlock); !ok {
+		t.Errorf("expecting mutex unlock statement but got %v", fn.Stmts[2])
+	}
+	if _, ok := fn.Stmts[3].(*migo.SyncRWMutexUnlock); !ok {
+		t.Errorf("expecting rwmutex unlock statement but got %v", fn.Stmts[3])
+	}
+}
+
+// Mutexes passed to a function using them as rwmutexes remain mutexes.
+func TestParseMutexParamRLock(t *testing.T) {
+	s := `def main(): letsync m mutex; call f(m); lock m; unlock m;
+def f(x): rlock x; runlock x;`
+	parsed, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	fn, found := parsed.Function("main")
+	if !found {
+		t.Error("cannot find main function")
+		t.FailNow()
+	}
+	if _, ok := fn.Stmts[2].(*migo.SyncMutexLock); !ok {
+		t.Errorf("expecting mutex lock statement but got %v", fn.Stmts[2])
+	}
+	if _, ok := fn.Stmts[3].(*migo.SyncMutexUnlock); !ok {
+		t.Errorf("expecting mutex unlock statement but got %v", fn.Stmts[3])
+	}
+}
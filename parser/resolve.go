@@ -0,0 +1,141 @@
+package parser
+
+import "github.com/nickng/migo/v3"
+
+// resolveRWMutex replaces the lock and unlock statements of rwmutexes in
+// prog, which are parsed as mutex statements, by the writer lock and unlock
+// statements of rwmutexes.
+//
+// A name in a function is a rwmutex if it is declared by letsync rwmutex,
+// used by rlock or runlock, or a parameter passed a rwmutex by a caller.
+// A global name is a rwmutex if it is used by rlock or runlock in any
+// function where it is not bound. A parameter passed both a mutex and a
+// rwmutex is a rwmutex: the statements are applied by the kind of the
+// resource (see package semantics). A name declared by letsync mutex is
+// never a rwmutex.
+func resolveRWMutex(prog *migo.Program) {
+	rw := make(map[*migo.Function]map[string]bool)
+	bound := make(map[*migo.Function]map[string]bool)
+	mutex := make(map[*migo.Function]map[string]bool) // declared by letsync mutex
+	globals := make(map[string]bool)
+	for _, fn := range prog.Funcs {
+		rw[fn] = make(map[string]bool)
+		bound[fn] = make(map[string]bool)
+		mutex[fn] = make(map[string]bool)
+		for _, p := range fn.Params {
+			bound[fn][p.Callee.Name()] = true
+		}
+		walkStmts(fn.Stmts, func(stmt migo.Statement) {
+			switch stmt := stmt.(type) {
+			case *migo.NewChanStatement:
+				bound[fn][stmt.Name.Name()] = true
+			case *migo.NewMem:
+				bound[fn][stmt.Name] = true
+			case *migo.NewSyncMutex:
+				bound[fn][stmt.Name] = true
+				mutex[fn][stmt.Name] = true
+			case *migo.NewSyncRWMutex:
+				bound[fn][stmt.Name] = true
+				rw[fn][stmt.Name] = true
+			case *migo.SyncRWMutexRLock:
+				rw[fn][stmt.Name] = true
+			case *migo.SyncRWMutexRUnlock:
+				rw[fn][stmt.Name] = true
+			}
+		})
+		for name := range mutex[fn] {
+			delete(rw[fn], name)
+		}
+	}
+	for _, fn := range prog.Funcs {
+		for name := range rw[fn] {
+			if !bound[fn][name] {
+				globals[name] = true
+			}
+		}
+	}
+	for _, fn := range prog.Funcs {
+		for name := range globals {
+			if !bound[fn][name] {
+				rw[fn][name] = true
+			}
+		}
+	}
+	pass := func(caller *migo.Function, name string, params []*migo.Parameter) bool {
+		callee, ok := prog.Function(name)
+		if !ok || len(callee.Params) != len(params) {
+			return false
+		}
+		changed := false
+		for i, p := range params {
+			x, y := p.Caller.Name(), callee.Params[i].Callee.Name()
+			if rw[caller][x] && !rw[callee][y] && !mutex[callee][y] {
+				rw[callee][y] = true
+				changed = true
+			}
+		}
+		return changed
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range prog.Funcs {
+			walkStmts(fn.Stmts, func(stmt migo.Statement) {
+				switch stmt := stmt.(type) {
+				case *migo.CallStatement:
+					changed = pass(fn, stmt.Name, stmt.Params) || changed
+				case *migo.SpawnStatement:
+					changed = pass(fn, stmt.Name, stmt.Params) || changed
+				}
+			})
+		}
+	}
+	for _, fn := range prog.Funcs {
+		replaceLocks(fn.Stmts, rw[fn])
+	}
+}
+
+// replaceLocks replaces in place the lock and unlock statements of the
+// rwmutexes in stmts.
+func replaceLocks(stmts []migo.Statement, rw map[string]bool) {
+	for i, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.SyncMutexLock:
+			if rw[stmt.Name] {
+				stmts[i] = &migo.SyncRWMutexLock{Name: stmt.Name}
+			}
+		case *migo.SyncMutexUnlock:
+			if rw[stmt.Name] {
+				stmts[i] = &migo.SyncRWMutexUnlock{Name: stmt.Name}
+			}
+		case *migo.IfStatement:
+			replaceLocks(stmt.Then, rw)
+			replaceLocks(stmt.Else, rw)
+		case *migo.IfForStatement:
+			replaceLocks(stmt.Then, rw)
+			replaceLocks(stmt.Else, rw)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				replaceLocks(c, rw)
+			}
+		}
+	}
+}
+
+// walkStmts calls visit on each statement of stmts, including nested ones.
+func walkStmts(stmts []migo.Statement, visit func(stmt migo.Statement)) {
+	for _, stmt := range stmts {
+		visit(stmt)
+		switch stmt := stmt.(type) {
+		case *migo.IfStatement:
+			walkStmts(stmt.Then, visit)
+			walkStmts(stmt.Else, visit)
+		case *migo.IfForStatement:
+			walkStmts(stmt.Then, visit)
+			walkStmts(stmt.Else, visit)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				walkStmts(c, visit)
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package passes
+
+// This file contains the Pass wrappers of the built-in passes.
+
+import (
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/internal/passes/canon"
+	"github.com/nickng/migo/v3/internal/passes/deadcall"
+	"github.com/nickng/migo/v3/internal/passes/deadparam"
+	"github.com/nickng/migo/v3/internal/passes/deadres"
+	"github.com/nickng/migo/v3/internal/passes/inline"
+	"github.com/nickng/migo/v3/internal/passes/merge"
+	"github.com/nickng/migo/v3/internal/passes/peephole"
+	"github.com/nickng/migo/v3/internal/passes/project"
+	"github.com/nickng/migo/v3/internal/passes/slice"
+	"github.com/nickng/migo/v3/internal/passes/taufunc"
+	"github.com/nickng/migo/v3/internal/passes/unused"
+)
+
+// TauFunc returns a Pass which removes functions reducible to τ,
+// except the functions named keep.
+func TauFunc(keep ...string) Pass {
+	return &tauFuncPass{keep: keep}
+}
+
+type tauFuncPass struct {
+	keep []string
+}
+
+func (p *tauFuncPass) Name() string       { return "taufunc" }
+func (p *tauFuncPass) Requires() []string { return nil }
+
+func (p *tauFuncPass) Run(prog *migo.Program) (*Result, error) {
+	keep := make(map[string]bool)
+	for _, name := range p.keep {
+		keep[name] = true
+	}
+	var removed []Removal
+	err := taufunc.Find(prog, func(fn *migo.Function) bool {
+		if keep[fn.Name] {
+			return false
+		}
+		removed = append(removed, Removal{Func: fn.Name, Reason: "reduces to τ"})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"removed-funcs": len(removed)},
+	}, nil
+}
+
+// Unused returns a Pass which removes functions unreachable from
+// the functions named entries. The Pass does nothing if none of the
+// entries is defined in the program.
+func Unused(entries ...string) Pass {
+	return &unusedPass{entries: entries}
+}
+
+type unusedPass struct {
+	entries []string
+}
+
+func (p *unusedPass) Name() string       { return "unused" }
+func (p *unusedPass) Requires() []string { return nil }
+
+func (p *unusedPass) Run(prog *migo.Program) (*Result, error) {
+	var entries []*migo.Function
+	for _, name := range p.entries {
+		if fn, ok := prog.Function(name); ok {
+			entries = append(entries, fn)
+		}
+	}
+	if len(entries) == 0 {
+		return &Result{}, nil
+	}
+	removedFns, err := unused.RemoveUnreachable(prog, entries...)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]Removal, len(removedFns))
+	for i, r := range removedFns {
+		removed[i] = Removal{Func: r.Func.Name, Reason: r.Reason}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"removed-funcs": len(removed)},
+	}, nil
+}
+
+// DeadCall returns a Pass which removes calls and spawns of
+// undefined functions.
+func DeadCall() Pass {
+	return deadCallPass{}
+}
+
+type deadCallPass struct{}
+
+func (deadCallPass) Name() string       { return "deadcall" }
+func (deadCallPass) Requires() []string { return nil }
+
+func (deadCallPass) Run(prog *migo.Program) (*Result, error) {
+	removedStmts := deadcall.Remove(prog)
+	removed := make([]Removal, len(removedStmts))
+	for i, r := range removedStmts {
+		removed[i] = Removal{Func: r.Func.Name, Stmt: r.Stmt, Reason: r.Reason}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"removed-stmts": len(removed)},
+	}, nil
+}
+
+// Inline returns a Pass which inlines calls of non-recursive functions of
+// at most maxCalleeSize statements, as long as the caller has at most
+// maxCallerSize statements after inlining. Spawns are never inlined.
+// If a size is not positive, the default of the pass is used.
+//
+// Inlined functions which are no longer called are not removed,
+// run the Unused pass after the Pass to remove them.
+func Inline(maxCalleeSize, maxCallerSize int) Pass {
+	return &inlinePass{opts: inline.Options{MaxCalleeSize: maxCalleeSize, MaxCallerSize: maxCallerSize}}
+}
+
+type inlinePass struct {
+	opts inline.Options
+}
+
+func (p *inlinePass) Name() string       { return "inline" }
+func (p *inlinePass) Requires() []string { return nil }
+
+func (p *inlinePass) Run(prog *migo.Program) (*Result, error) {
+	inlined, err := inline.Inline(prog, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]Removal, len(inlined))
+	for i, in := range inlined {
+		removed[i] = Removal{Func: in.Caller.Name, Stmt: in.Call, Reason: "inlined def " + in.Callee.Name}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"inlined-calls": len(removed)},
+	}, nil
+}
+
+// Merge returns a Pass which merges alpha-equivalent functions into one
+// representative function, and redirects calls and spawns of the merged
+// functions to the representative. The functions named keep are never
+// removed. The Result maps each merged function to its representative.
+func Merge(keep ...string) Pass {
+	return &mergePass{keep: keep}
+}
+
+type mergePass struct {
+	keep []string
+}
+
+func (p *mergePass) Name() string       { return "merge" }
+func (p *mergePass) Requires() []string { return nil }
+
+func (p *mergePass) Run(prog *migo.Program) (*Result, error) {
+	merged := merge.Merge(prog, p.keep...)
+	removed := make([]Removal, len(merged))
+	renamed := make(map[string]string)
+	for i, m := range merged {
+		removed[i] = Removal{Func: m.Func.Name, Reason: "merged into def " + m.Into.Name}
+		renamed[m.Func.Name] = m.Into.Name
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Renamed: renamed,
+		Stats:   map[string]int{"merged-funcs": len(removed)},
+	}, nil
+}
+
+// DeadParam returns a Pass which removes unused function parameters from
+// the function definitions and the arguments of every call and spawn.
+// A parameter is unused if it is not used for communication, memory access
+// or locking by the function or any function it is passed to.
+// The parameters of the functions named keep are never removed.
+func DeadParam(keep ...string) Pass {
+	return &deadParamPass{keep: keep}
+}
+
+type deadParamPass struct {
+	keep []string
+}
+
+func (p *deadParamPass) Name() string       { return "deadparam" }
+func (p *deadParamPass) Requires() []string { return nil }
+
+func (p *deadParamPass) Run(prog *migo.Program) (*Result, error) {
+	removedParams, err := deadparam.Remove(prog, p.keep...)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]Removal, len(removedParams))
+	for i, r := range removedParams {
+		removed[i] = Removal{Func: r.Func.Name, Param: r.Param, Reason: "unused"}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"removed-params": len(removed)},
+	}, nil
+}
+
+// DeadRes returns a Pass which removes declarations of channels, memory
+// locations and mutexes which are never used. The Pass requires the
+// DeadParam pass to run before it to remove the uses of the declarations
+// as arguments of functions which ignore them.
+func DeadRes() Pass {
+	return deadResPass{}
+}
+
+type deadResPass struct{}
+
+func (deadResPass) Name() string       { return "deadres" }
+func (deadResPass) Requires() []string { return []string{"deadparam"} }
+
+func (deadResPass) Run(prog *migo.Program) (*Result, error) {
+	removedDecls, err := deadres.Remove(prog)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]Removal, len(removedDecls))
+	for i, r := range removedDecls {
+		removed[i] = Removal{Func: r.Func.Name, Stmt: r.Stmt, Reason: r.Reason}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"removed-stmts": len(removed)},
+	}, nil
+}
+
+// Peephole returns a Pass which applies local algebraic simplifications
+// to if, select and τ statements, e.g. removing τ before other statements,
+// and replacing if statements with alpha-equivalent branches by the branch.
+// The Result Stats counts the number of times each rewrite rule is applied.
+func Peephole() Pass {
+	return peepholePass{}
+}
+
+type peepholePass struct{}
+
+func (peepholePass) Name() string       { return "peephole" }
+func (peepholePass) Requires() []string { return nil }
+
+func (peepholePass) Run(prog *migo.Program) (*Result, error) {
+	count := peephole.Rewrite(prog)
+	stats := make(map[string]int)
+	for rule, n := range count {
+		stats[rule.String()] = n
+	}
+	return &Result{Changed: len(count) > 0, Stats: stats}, nil
+}
+
+// Fragment is a set of fragments of the MiGo language.
+type Fragment int
+
+const (
+	ChanFragment    = Fragment(project.Chan)    // newchan, send, recv, close.
+	MemFragment     = Fragment(project.Mem)     // letmem, read, write.
+	MutexFragment   = Fragment(project.Mutex)   // letsync mutex, lock, unlock.
+	RWMutexFragment = Fragment(project.RWMutex) // letsync rwmutex, rlock, runlock.
+
+	AllFragments = ChanFragment | MemFragment | MutexFragment | RWMutexFragment
+)
+
+func (f Fragment) String() string { return project.Kind(f).String() }
+
+// Project returns a Pass which replaces the primitives of the fragments
+// not in keep by τ, e.g. to feed the program to a checker which only
+// supports channels. The Pass should be followed by simplification passes
+// to remove the τ statements and functions.
+func Project(keep Fragment) Pass {
+	return &projectPass{keep: keep}
+}
+
+type projectPass struct {
+	keep Fragment
+}
+
+func (p *projectPass) Name() string       { return "project" }
+func (p *projectPass) Requires() []string { return nil }
+
+func (p *projectPass) Run(prog *migo.Program) (*Result, error) {
+	replaced := project.Project(prog, project.Kind(p.keep))
+	removed := make([]Removal, len(replaced))
+	for i, r := range replaced {
+		removed[i] = Removal{Func: r.Func.Name, Stmt: r.Stmt, Reason: "replaced by τ: " + r.Kind.String() + " primitive"}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"replaced-stmts": len(removed)},
+	}, nil
+}
+
+// Slice returns a Pass which slices the program with respect to the
+// channels named chans, i.e. replaces all statements by τ except the
+// operations on the channels and the calls and spawns needed to reach
+// them. A name matches the declared name or the label of a newchan
+// statement, and the channels are followed through parameter passing.
+// The Pass should be followed by simplification passes to remove the τ
+// statements and functions.
+func Slice(chans ...string) Pass {
+	return &slicePass{chans: chans}
+}
+
+type slicePass struct {
+	chans []string
+}
+
+func (p *slicePass) Name() string       { return "slice" }
+func (p *slicePass) Requires() []string { return nil }
+
+func (p *slicePass) Run(prog *migo.Program) (*Result, error) {
+	replaced := slice.Slice(prog, p.chans...)
+	removed := make([]Removal, len(replaced))
+	for i, r := range replaced {
+		removed[i] = Removal{Func: r.Func.Name, Stmt: r.Stmt, Reason: "replaced by τ: not in slice"}
+	}
+	return &Result{
+		Changed: len(removed) > 0,
+		Removed: removed,
+		Stats:   map[string]int{"replaced-stmts": len(removed)},
+	}, nil
+}
+
+// Canonical returns a Pass which renames the parameters and declared
+// variables of each function to canonical names based on their position,
+// e.g. p0, p1, ch2 (with the newchan labels renamed as their variables),
+// and if funcs is set, renames the functions except keep to f0, f1, ... in
+// the order they are called from the functions in keep.
+// Canonical names are deterministic across extractions of the same program.
+// The Result maps the old names to the new names.
+func Canonical(funcs bool, keep ...string) Pass {
+	return &canonicalPass{opts: canon.Options{Funcs: funcs, Keep: keep}}
+}
+
+type canonicalPass struct {
+	opts canon.Options
+}
+
+func (p *canonicalPass) Name() string       { return "canonical" }
+func (p *canonicalPass) Requires() []string { return nil }
+
+func (p *canonicalPass) Run(prog *migo.Program) (*Result, error) {
+	renaming := canon.Rename(prog, p.opts)
+	changedVars := 0
+	for _, vars := range renaming.Vars {
+		for x, old := range vars {
+			if x != old {
+				changedVars++
+			}
+		}
+	}
+	changedFuncs := 0
+	for old, name := range renaming.Funcs {
+		if old != name {
+			changedFuncs++
+		}
+	}
+	return &Result{
+		Changed:     changedVars > 0 || changedFuncs > 0,
+		Renamed:     renaming.Funcs,
+		RenamedVars: renaming.Vars,
+		Stats:       map[string]int{"renamed-vars": changedVars, "renamed-funcs": changedFuncs},
+	}, nil
+}
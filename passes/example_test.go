@@ -0,0 +1,31 @@
+package passes_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nickng/migo/v3/parser"
+	"github.com/nickng/migo/v3/passes"
+)
+
+// This example demonstrates simplifying a program with a Pipeline.
+func ExamplePipeline() {
+	s := `def main(): call work(); call sndr(); call recvr();
+	def work(): tau;
+	def sndr(): send ch;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pl := passes.NewPipeline(passes.TauFunc("main"), passes.Unused("main"), passes.DeadCall())
+	if _, err := pl.Run(prog); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(prog)
+	// Output:
+	// def main():
+	//     call sndr();
+	// def sndr():
+	//     send ch;
+}
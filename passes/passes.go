@@ -0,0 +1,274 @@
+// Package passes defines a framework for transformation passes on MiGo
+// programs, and the built-in passes of the library.
+//
+// A Pass transforms a migo.Program in place and reports the changes made.
+// Passes are composed with a Pipeline, which runs them in order, optionally
+// repeating until no pass changes the program (fixpoint), and records the
+// time taken and the changes made by each pass.
+//
+// # Usage
+//
+// To remove τ functions and dead calls, then print the report:
+//
+//	pl := passes.NewPipeline(passes.TauFunc(), passes.DeadCall())
+//	report, err := pl.Run(prog)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Print(report)
+package passes
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nickng/migo/v3"
+)
+
+// DefaultMaxIterations is the maximum number of iterations
+// of a fixpoint Pipeline if not specified.
+const DefaultMaxIterations = 10
+
+// Pass is a transformation pass on MiGo programs.
+type Pass interface {
+	// Name returns the name of the pass.
+	Name() string
+
+	// Requires returns the names of the passes
+	// that must run before the pass in a Pipeline.
+	Requires() []string
+
+	// Run runs the pass on Program prog, which is modified in place,
+	// and returns a report of the changes.
+	Run(prog *migo.Program) (*Result, error)
+}
+
+// Result is a report of the changes made by a Pass.
+type Result struct {
+	Changed bool              // Whether the program is changed.
+	Removed []Removal         // Functions, statements and parameters removed.
+	Renamed map[string]string // Functions renamed or merged, from old to new name.
+	Stats   map[string]int    // Pass-specific statistics, e.g. number of functions removed.
+
+	// RenamedVars is the variables renamed in each function (by the new
+	// function name), from new to old name, as a name declared more than
+	// once in a function can be renamed to more than one new name.
+	RenamedVars map[string]map[string]string
+}
+
+// Removal is a function, a statement or a parameter removed by a Pass.
+type Removal struct {
+	Func   string         // Name of function removed or containing the statement or parameter removed.
+	Stmt   migo.Statement // Statement removed, or nil if not a statement.
+	Param  string         // Parameter removed, or empty if not a parameter.
+	Reason string         // Reason of removal.
+}
+
+func (r Removal) String() string {
+	if r.Param != "" {
+		return fmt.Sprintf("parameter %s of def %s: %s", r.Param, r.Func, r.Reason)
+	}
+	if r.Stmt == nil {
+		return fmt.Sprintf("def %s: %s", r.Func, r.Reason)
+	}
+	return fmt.Sprintf("%s in def %s: %s", r.Stmt, r.Func, r.Reason)
+}
+
+// Pipeline is a sequence of Passes.
+type Pipeline struct {
+	Passes []Pass
+
+	// Fixpoint repeats the Passes until none of the Passes
+	// changes the program, or MaxIterations is reached.
+	Fixpoint bool
+
+	// MaxIterations is the maximum number of iterations in Fixpoint mode.
+	// DefaultMaxIterations is used if MaxIterations is not positive.
+	MaxIterations int
+
+	// Dump is where the program is written to after each pass,
+	// for debugging. Nothing is written if Dump is nil.
+	Dump io.Writer
+}
+
+// NewPipeline creates a new Pipeline which runs passes in order.
+func NewPipeline(passes ...Pass) *Pipeline {
+	return &Pipeline{Passes: passes}
+}
+
+// ErrRequirement is the error if a Pass in a Pipeline
+// is not preceded by a Pass it requires.
+type ErrRequirement struct {
+	Pass     string // Name of Pass.
+	Requires string // Name of required Pass.
+}
+
+func (e *ErrRequirement) Error() string {
+	return fmt.Sprintf("pass %s requires pass %s to run before it", e.Pass, e.Requires)
+}
+
+// ErrPass is the error returned by a Pass in a Pipeline.
+type ErrPass struct {
+	Pass string // Name of Pass.
+	Err  error  // Error returned by the Pass.
+}
+
+func (e *ErrPass) Error() string {
+	return fmt.Sprintf("%s: %v", e.Pass, e.Err)
+}
+
+// Unwrap returns the error returned by the Pass.
+func (e *ErrPass) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks that the requirements of all Passes in the Pipeline are
+// met, i.e. each Pass is preceded by the Passes it requires.
+func (p *Pipeline) Validate() error {
+	seen := make(map[string]bool)
+	for _, pass := range p.Passes {
+		for _, req := range pass.Requires() {
+			if !seen[req] {
+				return &ErrRequirement{Pass: pass.Name(), Requires: req}
+			}
+		}
+		seen[pass.Name()] = true
+	}
+	return nil
+}
+
+// Run runs the Pipeline on Program prog, which is modified in place.
+//
+// If a Pass returns an error, Run stops and returns the report so far
+// with the error wrapped in an *ErrPass.
+func (p *Pipeline) Run(prog *migo.Program) (*Report, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	maxIter := 1
+	if p.Fixpoint {
+		maxIter = p.MaxIterations
+		if maxIter <= 0 {
+			maxIter = DefaultMaxIterations
+		}
+	}
+	report := &Report{inputs: make(map[string]bool)}
+	for _, fn := range prog.Funcs {
+		report.inputs[fn.Name] = true
+	}
+	for iter := 1; iter <= maxIter; iter++ {
+		report.Iterations = iter
+		changed := false
+		for _, pass := range p.Passes {
+			start := time.Now()
+			result, err := pass.Run(prog)
+			if err != nil {
+				return report, &ErrPass{Pass: pass.Name(), Err: err}
+			}
+			if result == nil {
+				result = new(Result)
+			}
+			report.Runs = append(report.Runs, &PassRun{
+				Pass:      pass.Name(),
+				Iteration: iter,
+				Duration:  time.Since(start),
+				Result:    result,
+			})
+			changed = changed || result.Changed
+			if p.Dump != nil {
+				fmt.Fprintf(p.Dump, "-- after %s (iteration %d) --\n%s", pass.Name(), iter, prog)
+			}
+		}
+		if !changed {
+			report.Converged = true
+			break
+		}
+	}
+	return report, nil
+}
+
+// Report is a report of a Pipeline run.
+type Report struct {
+	Runs       []*PassRun // Runs of Passes in execution order.
+	Iterations int        // Number of iterations of the Pipeline.
+	Converged  bool       // Whether the last iteration made no change.
+
+	inputs map[string]bool // functions of the input program
+}
+
+// PassRun is a run of a Pass in a Pipeline.
+type PassRun struct {
+	Pass      string        // Name of the Pass.
+	Iteration int           // Iteration of the Pipeline (starting from 1).
+	Duration  time.Duration // Time taken by the Pass.
+	Result    *Result
+}
+
+// Removed returns all functions, statements and parameters removed by the Passes
+// in the Pipeline, in the order of removal.
+func (r *Report) Removed() []Removal {
+	var removed []Removal
+	for _, run := range r.Runs {
+		removed = append(removed, run.Result.Removed...)
+	}
+	return removed
+}
+
+// Renamed returns the functions renamed or merged by the Passes in the
+// Pipeline, from the name in the input program to the name in the output
+// program, following functions renamed more than once. The intermediate
+// names of functions renamed more than once are not included, unless they
+// are also functions of the input program (e.g. the representative of
+// merged functions).
+func (r *Report) Renamed() map[string]string {
+	renamed := make(map[string]string)
+	for _, run := range r.Runs {
+		targets := make(map[string]bool) // names of earlier renames
+		for old, name := range renamed {
+			targets[name] = true
+			if next, ok := run.Result.Renamed[name]; ok {
+				renamed[old] = next
+			}
+		}
+		for old, name := range run.Result.Renamed {
+			if _, ok := renamed[old]; ok || (targets[old] && !r.inputs[old]) {
+				continue
+			}
+			renamed[old] = name
+		}
+	}
+	return renamed
+}
+
+// Changed returns true if any Pass in the Pipeline changed the program.
+func (r *Report) Changed() bool {
+	for _, run := range r.Runs {
+		if run.Result.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	for _, run := range r.Runs {
+		sb.WriteString(fmt.Sprintf("%d\t%s\t%v\tchanged=%t", run.Iteration, run.Pass, run.Duration, run.Result.Changed))
+		keys := make([]string, 0, len(run.Result.Stats))
+		for k := range run.Result.Stats {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sb.WriteString(fmt.Sprintf("\t%s=%d", k, run.Result.Stats[k]))
+		}
+		sb.WriteString("\n")
+		for _, removal := range run.Result.Removed {
+			sb.WriteString(fmt.Sprintf("\t- %s\n", removal))
+		}
+	}
+	return sb.String()
+}
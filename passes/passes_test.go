@@ -0,0 +1,336 @@
+package passes_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/parser"
+	"github.com/nickng/migo/v3/passes"
+)
+
+// dropFirst is a custom pass which removes the first statement of
+// function fn if there are more than one statements.
+type dropFirst struct {
+	fn       string
+	requires []string
+}
+
+func (p *dropFirst) Name() string       { return "dropfirst" }
+func (p *dropFirst) Requires() []string { return p.requires }
+
+func (p *dropFirst) Run(prog *migo.Program) (*passes.Result, error) {
+	fn, ok := prog.Function(p.fn)
+	if !ok {
+		return nil, errors.New("function not found")
+	}
+	if len(fn.Stmts) <= 1 {
+		return &passes.Result{}, nil
+	}
+	fn.Stmts = fn.Stmts[1:]
+	return &passes.Result{Changed: true, Stats: map[string]int{"removed-stmts": 1}}, nil
+}
+
+func TestPipeline(t *testing.T) {
+	s := `
+def main(): send x; recv x; call a(); call b();
+def a(): tau;
+def b(): recv y;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var dump bytes.Buffer
+	pl := passes.NewPipeline(passes.TauFunc("main"), &dropFirst{fn: "main"}, passes.DeadCall())
+	pl.Dump = &dump
+	report, err := pl.Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, len(report.Runs); want != got {
+		t.Fatalf("expected %d pass runs but got %d", want, got)
+	}
+	for i, name := range []string{"taufunc", "dropfirst", "deadcall"} {
+		if want, got := name, report.Runs[i].Pass; want != got {
+			t.Errorf("run[%d]: expected pass %s but got %s", i, want, got)
+		}
+		if !report.Runs[i].Result.Changed {
+			t.Errorf("run[%d]: expected pass %s to change program", i, name)
+		}
+	}
+	if want, got := 1, report.Runs[0].Result.Stats["removed-funcs"]; want != got {
+		t.Errorf("expected %d function removed by taufunc but got %d", want, got)
+	}
+	if want, got := "def main():\n    recv x;\n    call b();\n", prog.Funcs[0].String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+	if want, got := 3, strings.Count(dump.String(), "-- after "); want != got {
+		t.Errorf("expected %d program dumps but got %d:\n%s", want, got, dump.String())
+	}
+	if !report.Changed() || report.Iterations != 1 {
+		t.Errorf("expected changed program in 1 iteration but got %d:\n%s", report.Iterations, report)
+	}
+}
+
+func TestPipelineFixpoint(t *testing.T) {
+	s := `def main(): send x; send x; send x; send x;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	pl := passes.NewPipeline(&dropFirst{fn: "main"})
+	pl.Fixpoint = true
+	report, err := pl.Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 4, report.Iterations; want != got {
+		t.Errorf("expected %d iterations but got %d", want, got)
+	}
+	if !report.Converged {
+		t.Errorf("expected pipeline to converge")
+	}
+	if want, got := 1, len(prog.Funcs[0].Stmts); want != got {
+		t.Errorf("expected %d statement after fixpoint but got %d", want, got)
+	}
+
+	prog, _ = parser.Parse(strings.NewReader(s))
+	pl.MaxIterations = 2
+	report, err = pl.Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Converged || report.Iterations != 2 {
+		t.Errorf("expected pipeline to stop after 2 iterations without converging but got %d", report.Iterations)
+	}
+}
+
+func TestPipelineRequires(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(`def main(): send x;`))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	pl := passes.NewPipeline(&dropFirst{fn: "main", requires: []string{"deadcall"}}, passes.DeadCall())
+	_, err = pl.Run(prog)
+	var reqErr *passes.ErrRequirement
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected requirement error but got %v", err)
+	}
+	if want, got := "deadcall", reqErr.Requires; want != got {
+		t.Errorf("expected %s to be required but got %s", want, got)
+	}
+	pl.Passes[0], pl.Passes[1] = pl.Passes[1], pl.Passes[0]
+	if _, err := pl.Run(prog); err != nil {
+		t.Errorf("expected requirements to be met but got %v", err)
+	}
+}
+
+func TestPipelineError(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(`def main(): send x;`))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(passes.DeadCall(), &dropFirst{fn: "f"}).Run(prog)
+	var passErr *passes.ErrPass
+	if !errors.As(err, &passErr) || passErr.Pass != "dropfirst" {
+		t.Fatalf("expected error from dropfirst but got %v", err)
+	}
+	if want, got := 1, len(report.Runs); want != got {
+		t.Errorf("expected %d pass run before error but got %d", want, got)
+	}
+}
+
+func TestInline(t *testing.T) {
+	s := `
+def main(): let c = newchan c, 0; spawn a(c); call b(c);
+def a(x): send x;
+def b(y): recv y;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(passes.Inline(0, 0), passes.Unused("main")).Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, report.Runs[0].Result.Stats["inlined-calls"]; want != got {
+		t.Errorf("expected %d call inlined but got %d", want, got)
+	}
+	if want, got := "def main():\n    let c = newchan c, 0;\n    spawn a(c);\n    recv c;\ndef a(x):\n    send x;\n", prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	s := `
+def main(): spawn a(x); spawn b(y); call c(z);
+def a(p): send p; call a2(p);
+def a2(p): recv p;
+def b(q): send q; call b2(q);
+def b2(q): recv q;
+def c(r): send r; call c2(r);
+def c2(r): recv r;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(passes.Merge("main")).Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 4, report.Runs[0].Result.Stats["merged-funcs"]; want != got {
+		t.Errorf("expected %d functions merged but got %d", want, got)
+	}
+	renamed := report.Renamed()
+	for old, name := range map[string]string{"b": "a", "b2": "a2", "c": "a", "c2": "a2"} {
+		if want, got := name, renamed[old]; want != got {
+			t.Errorf("expected %s merged into %s but got %s", old, want, got)
+		}
+	}
+	if want, got := "def main():\n    spawn a(x);\n    spawn a(y);\n    call a(z);\n", prog.Funcs[0].String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+// Renamed follows functions renamed by more than one pass, without the
+// intermediate names.
+func TestRenamedChain(t *testing.T) {
+	s := `
+def main(): spawn a#1(x); spawn b#1(y);
+def a#1(p): send p;
+def b#1(q): send q;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(
+		passes.Merge("main"),
+		passes.Canonical(true, "main"),
+		passes.Canonical(true, "main")).Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := report.Renamed()
+	for old, name := range map[string]string{"a#1": "f0", "b#1": "f0"} {
+		if want, got := name, renamed[old]; want != got {
+			t.Errorf("expected %s renamed to %s but got %s", old, want, got)
+		}
+	}
+	if want, got := 2, len(renamed); want != got {
+		t.Errorf("expected %d functions renamed but got %d: %v", want, got, renamed)
+	}
+}
+
+func TestDeadParam(t *testing.T) {
+	s := `
+def main(): spawn f(a, b, c);
+def f(x, y, z): send x; call f(x, y, z);
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(passes.DeadParam("main")).Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := report.Removed()
+	if want, got := 2, len(removed); want != got {
+		t.Fatalf("expected %d parameters removed but got %d: %v", want, got, removed)
+	}
+	if want, got := "parameter y of def f: unused", removed[0].String(); want != got {
+		t.Errorf("expected removal %q but got %q", want, got)
+	}
+	if want, got := "def main():\n    spawn f(a);\ndef f(x):\n    send x;\n    call f(x);\n", prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+func TestDeadRes(t *testing.T) {
+	s := `
+def main(): let a = newchan a, 0; send b; call f(a);
+def f(x): let c = newchan c, 0; call g(x, c);
+def g(y, z): tau;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var errReq *passes.ErrRequirement
+	if err := passes.NewPipeline(passes.DeadRes()).Validate(); !errors.As(err, &errReq) {
+		t.Errorf("expected requirement error but got %v", err)
+	}
+	pl := passes.NewPipeline(passes.DeadParam("main"), passes.DeadRes(), passes.TauFunc("main"), passes.DeadCall())
+	pl.Fixpoint = true
+	report, err := pl.Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Converged {
+		t.Errorf("expected pipeline to converge but got:\n%s", report)
+	}
+	if want, got := "def main():\n    send b;\n", prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
+
+func TestPeephole(t *testing.T) {
+	s := `def main(): tau; if send x; tau; else send x; endif; select case recv y; endselect;`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(passes.Peephole()).Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "def main():\n    send x;\n    recv y;\n", prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+	for _, rule := range []string{"drop-tau", "if-equal", "select-flatten"} {
+		if report.Runs[0].Result.Stats[rule] == 0 {
+			t.Errorf("expected rule %s applied but got %v", rule, report.Runs[0].Result.Stats)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	s := `
+def main(): let t3 = newchan t3, 0; spawn w#1(t3); recv t3;
+def w#1(t5): send t5;
+`
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	report, err := passes.NewPipeline(passes.Canonical(true, "main")).Run(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "f0", report.Renamed()["w#1"]; want != got {
+		t.Errorf("expected w#1 renamed to %s but got %s", want, got)
+	}
+	if want, got := "t5", report.Runs[0].Result.RenamedVars["f0"]["p0"]; want != got {
+		t.Errorf("expected p0 of f0 renamed from %s but got %s", want, got)
+	}
+	if want, got := "def main():\n    let ch0 = newchan ch0, 0;\n    spawn f0(ch0);\n    recv ch0;\ndef f0(p0):\n    send p0;\n", prog.String(); want != got {
+		t.Errorf("unexpected program, want:\n%sgot:\n%s", want, got)
+	}
+}
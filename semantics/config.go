@@ -0,0 +1,514 @@
+// Package semantics defines the operational semantics of MiGo programs
+// as a labelled transition system.
+//
+// A Config (configuration) is the state of a running program: a set of
+// processes (goroutines), each with a stack of Frames holding the
+// continuation of the process, and the resources created so far, i.e.
+// channels with their buffers, memory locations, mutexes and rwmutexes.
+//
+// Successors computes the transitions enabled in a configuration by the
+// reduction rules of the statements:
+//
+//	send, recv     synchronise a sender and a receiver on an unbuffered
+//	               channel, or enqueue/dequeue on a buffered channel;
+//	               a receive on a closed empty channel always succeeds
+//	close          close a channel
+//	select         fire any enabled case (a τ guard is always enabled)
+//	if, ifFor      choose the then or else branch
+//	call           push a frame of the callee
+//	spawn          create a new process running the callee
+//	let, letmem,   create a new resource
+//	letsync
+//	lock, unlock   acquire (if free) and release a mutex
+//	rlock, runlock acquire (if not write-locked, and no writer is waiting
+//	               for the readers) and release a read lock of a rwmutex
+//	lock, unlock   acquire (if free) and release the write lock of a
+//	(rwmutex)      rwmutex
+//	read, write    access a memory location
+//	tau            internal step
+//
+// A send on a closed channel, a close of a closed channel and unlock of a
+// free mutex or rwmutex make the program panic: the resulting configuration has no
+// successors. Calls and spawns of undefined functions are τ steps.
+// Names which are not declared nor parameters of a function (globals) are
+// created once for the whole program, with the kind of resource inferred
+// from their use.
+//
+// Configurations are immutable: Successors returns new configurations
+// sharing the unchanged parts with the original.
+package semantics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// ID is the identifier of a resource in a configuration.
+type ID int
+
+// Chan is the state of a channel.
+type Chan struct {
+	Name   string // Name of the channel when created.
+	Label  string // Label (type) of the channel in newchan.
+	Cap    int    // Capacity of the buffer.
+	Len    int    // Number of values in the buffer.
+	Closed bool   // Whether the channel is closed.
+
+	// Decl is the newchan statement which created the channel,
+	// or nil for a global channel.
+	Decl *migo.NewChanStatement
+}
+
+// Mutex is the state of a mutex.
+type Mutex struct {
+	Name   string // Name of the mutex when created.
+	Locked bool   // Whether the mutex is locked.
+	Holder int    // PID of the process which locked the mutex, or -1.
+}
+
+// RWMutex is the state of a rwmutex.
+type RWMutex struct {
+	Name    string // Name of the rwmutex when created.
+	Readers []int  // PIDs of the processes holding read locks (sorted).
+	Writer  int    // PID of the process holding the write lock, or -1.
+}
+
+// Mem is a memory location.
+type Mem struct {
+	Name string // Name of the memory location when created.
+}
+
+// Frame is a frame of the stack of a process.
+type Frame struct {
+	Func  *migo.Function   // Function of the frame.
+	Stmts []migo.Statement // Statements to run (continuation).
+	Env   map[string]ID    // Resources of variables in scope (shared, never modified).
+	Block bool             // Whether the frame is a block (branch or case) in Func.
+}
+
+// Proc is a process (goroutine).
+type Proc struct {
+	PID   int
+	Stack []Frame // Continuation stack, top last.
+}
+
+// Top returns the top frame of the process.
+func (p *Proc) Top() *Frame {
+	return &p.Stack[len(p.Stack)-1]
+}
+
+// Stmt returns the next statement of the process.
+func (p *Proc) Stmt() migo.Statement {
+	return p.Top().Stmts[0]
+}
+
+// Func returns the function the process is running.
+func (p *Proc) Func() *migo.Function {
+	return p.Top().Func
+}
+
+func (p *Proc) String() string {
+	return fmt.Sprintf("%d@%s: %s", p.PID, p.Func().Name, p.Stmt())
+}
+
+// Config is a configuration of a program.
+type Config struct {
+	Procs     []*Proc // Processes, sorted by PID.
+	Chans     map[ID]*Chan
+	Mutexes   map[ID]*Mutex
+	RWMutexes map[ID]*RWMutex
+	Mems      map[ID]*Mem
+	Globals   map[string]ID // Resources of global names.
+	Panic     string        // Reason of panic, or empty if not panicked.
+
+	prog   *migo.Program
+	nextID ID
+}
+
+// ErrArity is the error if a function is called or spawned with a number
+// of arguments different from its number of parameters.
+type ErrArity struct {
+	Stmt migo.Statement // Call or spawn statement.
+	Func *migo.Function // Function called.
+}
+
+func (e *ErrArity) Error() string {
+	return fmt.Sprintf("%s: def %s has %d parameters", e.Stmt, e.Func.Name, len(e.Func.Params))
+}
+
+// ErrNoEntry is the error if the entry function is not defined.
+type ErrNoEntry struct {
+	Entry string
+}
+
+func (e *ErrNoEntry) Error() string {
+	return fmt.Sprintf("entry function %s not found", e.Entry)
+}
+
+// NewConfig returns the initial configuration of Program prog,
+// with one process running the function named entry.
+// The parameters of the entry function are global names.
+//
+// An *migo.ErrUnknownStatement is returned if prog contains a statement
+// not defined in the migo package (including a migo.CustomStatement), as
+// its semantics is unknown, and an *ErrArity if prog calls or spawns a
+// function with the wrong number of arguments.
+func NewConfig(prog *migo.Program, entry string) (*Config, error) {
+	fn, ok := prog.Function(entry)
+	if !ok {
+		return nil, &ErrNoEntry{Entry: entry}
+	}
+	c := &Config{
+		Chans:     make(map[ID]*Chan),
+		Mutexes:   make(map[ID]*Mutex),
+		RWMutexes: make(map[ID]*RWMutex),
+		Mems:      make(map[ID]*Mem),
+		Globals:   make(map[string]ID),
+		prog:      prog,
+	}
+	globals := make(map[string]migo.Statement) // name → first use
+	var names []string
+	for _, f := range prog.Funcs {
+		params := make(map[string]bool)
+		if f != fn {
+			for _, p := range f.Params {
+				params[p.Callee.Name()] = true
+			}
+		}
+		if err := c.scan(f.Stmts, params, globals, &names); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		id := c.alloc()
+		c.Globals[name] = id
+		switch globals[name].(type) {
+		case *migo.MemRead, *migo.MemWrite:
+			c.Mems[id] = &Mem{Name: name}
+		case *migo.SyncMutexLock, *migo.SyncMutexUnlock:
+			c.Mutexes[id] = &Mutex{Name: name, Holder: -1}
+		case *migo.SyncRWMutexRLock, *migo.SyncRWMutexRUnlock, *migo.SyncRWMutexLock, *migo.SyncRWMutexUnlock:
+			c.RWMutexes[id] = &RWMutex{Name: name, Writer: -1}
+		default:
+			c.Chans[id] = &Chan{Name: name, Label: name}
+		}
+	}
+	c.Procs = []*Proc{{PID: 0, Stack: []Frame{{Func: fn, Stmts: fn.Stmts, Env: map[string]ID{}}}}}
+	c.normalise(c.Procs[0])
+	return c, nil
+}
+
+// scan checks the statements in stmts, and records the global names,
+// i.e. names not bound in stmts nor in bound, with their first use.
+func (c *Config) scan(stmts []migo.Statement, bound map[string]bool, globals map[string]migo.Statement, names *[]string) error {
+	use := func(name string, stmt migo.Statement) {
+		if bound[name] {
+			return
+		}
+		if _, seen := globals[name]; !seen {
+			*names = append(*names, name)
+			globals[name] = stmt
+		} else if _, isCall := globals[name].(*migo.CallStatement); isCall {
+			globals[name] = stmt // prefer a use which tells the kind
+		}
+	}
+	bind := func(name string) {
+		ext := map[string]bool{name: true}
+		for k := range bound {
+			ext[k] = true
+		}
+		bound = ext
+	}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			bind(stmt.Name.Name())
+		case *migo.NewMem:
+			bind(stmt.Name)
+		case *migo.NewSyncMutex:
+			bind(stmt.Name)
+		case *migo.NewSyncRWMutex:
+			bind(stmt.Name)
+		case *migo.SendStatement:
+			use(stmt.Chan, stmt)
+		case *migo.RecvStatement:
+			use(stmt.Chan, stmt)
+		case *migo.CloseStatement:
+			use(stmt.Chan, stmt)
+		case *migo.MemRead:
+			use(stmt.Name, stmt)
+		case *migo.MemWrite:
+			use(stmt.Name, stmt)
+		case *migo.SyncMutexLock:
+			use(stmt.Name, stmt)
+		case *migo.SyncMutexUnlock:
+			use(stmt.Name, stmt)
+		case *migo.SyncRWMutexRLock:
+			use(stmt.Name, stmt)
+		case *migo.SyncRWMutexRUnlock:
+			use(stmt.Name, stmt)
+		case *migo.SyncRWMutexLock:
+			use(stmt.Name, stmt)
+		case *migo.SyncRWMutexUnlock:
+			use(stmt.Name, stmt)
+		case *migo.TauStatement:
+		case *migo.CallStatement:
+			if err := c.checkArity(stmt, stmt.Name, len(stmt.Params)); err != nil {
+				return err
+			}
+			for _, p := range stmt.Params {
+				use(p.Caller.Name(), (*migo.CallStatement)(nil))
+			}
+		case *migo.SpawnStatement:
+			if err := c.checkArity(stmt, stmt.Name, len(stmt.Params)); err != nil {
+				return err
+			}
+			for _, p := range stmt.Params {
+				use(p.Caller.Name(), (*migo.CallStatement)(nil))
+			}
+		case *migo.IfStatement:
+			if err := c.scan(stmt.Then, bound, globals, names); err != nil {
+				return err
+			}
+			if err := c.scan(stmt.Else, bound, globals, names); err != nil {
+				return err
+			}
+		case *migo.IfForStatement:
+			if err := c.scan(stmt.Then, bound, globals, names); err != nil {
+				return err
+			}
+			if err := c.scan(stmt.Else, bound, globals, names); err != nil {
+				return err
+			}
+		case *migo.SelectStatement:
+			for _, cs := range stmt.Cases {
+				if err := c.scan(cs, bound, globals, names); err != nil {
+					return err
+				}
+			}
+		default:
+			return &migo.ErrUnknownStatement{Stmt: stmt}
+		}
+	}
+	return nil
+}
+
+func (c *Config) checkArity(stmt migo.Statement, name string, n int) error {
+	if fn, ok := c.prog.Function(name); ok && len(fn.Params) != n {
+		return &ErrArity{Stmt: stmt, Func: fn}
+	}
+	return nil
+}
+
+// Program returns the program of the configuration.
+func (c *Config) Program() *migo.Program {
+	return c.prog
+}
+
+// Proc returns the process with the given pid.
+func (c *Config) Proc(pid int) (*Proc, bool) {
+	i := sort.Search(len(c.Procs), func(i int) bool { return c.Procs[i].PID >= pid })
+	if i < len(c.Procs) && c.Procs[i].PID == pid {
+		return c.Procs[i], true
+	}
+	return nil, false
+}
+
+// Terminated returns true if all processes have terminated.
+func (c *Config) Terminated() bool {
+	return len(c.Procs) == 0
+}
+
+// Lookup returns the resource of the variable name of the process.
+func (c *Config) Lookup(p *Proc, name string) (ID, bool) {
+	if id, ok := p.Top().Env[name]; ok {
+		return id, true
+	}
+	id, ok := c.Globals[name]
+	return id, ok
+}
+
+// ResourceName returns the name of resource id when created.
+func (c *Config) ResourceName(id ID) string {
+	if ch, ok := c.Chans[id]; ok {
+		return ch.Name
+	}
+	if m, ok := c.Mutexes[id]; ok {
+		return m.Name
+	}
+	if m, ok := c.RWMutexes[id]; ok {
+		return m.Name
+	}
+	if m, ok := c.Mems[id]; ok {
+		return m.Name
+	}
+	return fmt.Sprintf("#%d", id)
+}
+
+func (c *Config) alloc() ID {
+	id := c.nextID
+	c.nextID++
+	return id
+}
+
+// clone returns a shallow copy of the configuration,
+// which shares the processes and resources with c.
+func (c *Config) clone() *Config {
+	n := *c
+	n.Procs = append([]*Proc(nil), c.Procs...)
+	n.Chans = make(map[ID]*Chan, len(c.Chans))
+	for k, v := range c.Chans {
+		n.Chans[k] = v
+	}
+	n.Mutexes = make(map[ID]*Mutex, len(c.Mutexes))
+	for k, v := range c.Mutexes {
+		n.Mutexes[k] = v
+	}
+	n.RWMutexes = make(map[ID]*RWMutex, len(c.RWMutexes))
+	for k, v := range c.RWMutexes {
+		n.RWMutexes[k] = v
+	}
+	n.Mems = make(map[ID]*Mem, len(c.Mems))
+	for k, v := range c.Mems {
+		n.Mems[k] = v
+	}
+	return &n
+}
+
+// proc returns a copy of the process pid in c (which must be a clone),
+// which can be modified.
+func (c *Config) proc(pid int) *Proc {
+	for i, p := range c.Procs {
+		if p.PID == pid {
+			n := &Proc{PID: p.PID, Stack: append([]Frame(nil), p.Stack...)}
+			c.Procs[i] = n
+			return n
+		}
+	}
+	panic(fmt.Sprintf("process %d not found", pid))
+}
+
+// normalise pops the finished frames of process p,
+// and removes p if it has terminated.
+func (c *Config) normalise(p *Proc) {
+	for len(p.Stack) > 0 && len(p.Top().Stmts) == 0 {
+		p.Stack = p.Stack[:len(p.Stack)-1]
+	}
+	if len(p.Stack) == 0 {
+		for i, q := range c.Procs {
+			if q == p {
+				c.Procs = append(c.Procs[:i:i], c.Procs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Key returns a string which is equal for configurations equal up to
+// renaming of resources, e.g. for detecting visited configurations.
+func (c *Config) Key() string {
+	var sb strings.Builder
+	ids := make(map[ID]int) // canonical resource numbers
+	var order []ID
+	ref := func(id ID) int {
+		if n, ok := ids[id]; ok {
+			return n
+		}
+		ids[id] = len(ids)
+		order = append(order, id)
+		return ids[id]
+	}
+	if c.Panic != "" {
+		sb.WriteString("panic:" + c.Panic + ";")
+	}
+	globals := make([]string, 0, len(c.Globals))
+	for name := range c.Globals {
+		globals = append(globals, name)
+	}
+	sort.Strings(globals)
+	for _, name := range globals {
+		ref(c.Globals[name])
+	}
+	for _, p := range c.Procs {
+		sb.WriteString(fmt.Sprintf("%d[", p.PID))
+		for _, f := range p.Stack {
+			sb.WriteString(fmt.Sprintf("%p:%d{", f.Func, len(f.Stmts)))
+			if len(f.Stmts) > 0 {
+				sb.WriteString(fmt.Sprintf("%p", &f.Stmts[0]))
+			}
+			vars := make([]string, 0, len(f.Env))
+			for name := range f.Env {
+				vars = append(vars, name)
+			}
+			sort.Strings(vars)
+			for _, name := range vars {
+				sb.WriteString(fmt.Sprintf(" %s=%d", name, ref(f.Env[name])))
+			}
+			sb.WriteString("}")
+		}
+		sb.WriteString("]")
+	}
+	sb.WriteString("|")
+	for n, id := range order {
+		sb.WriteString(fmt.Sprintf("%d:", n))
+		if ch, ok := c.Chans[id]; ok {
+			sb.WriteString(fmt.Sprintf("c%d/%d/%t;", ch.Cap, ch.Len, ch.Closed))
+		} else if m, ok := c.Mutexes[id]; ok {
+			sb.WriteString(fmt.Sprintf("m%t/%d;", m.Locked, m.Holder))
+		} else if m, ok := c.RWMutexes[id]; ok {
+			sb.WriteString(fmt.Sprintf("rw%v/%d;", m.Readers, m.Writer))
+		} else {
+			sb.WriteString("mem;")
+		}
+	}
+	return sb.String()
+}
+
+func (c *Config) String() string {
+	var sb strings.Builder
+	if c.Panic != "" {
+		sb.WriteString(fmt.Sprintf("panic: %s\n", c.Panic))
+	}
+	for _, p := range c.Procs {
+		sb.WriteString(fmt.Sprintf("  %s\n", p))
+	}
+	ids := make([]int, 0, len(c.Chans))
+	for id := range c.Chans {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		ch := c.Chans[ID(id)]
+		sb.WriteString(fmt.Sprintf("  chan %s#%d: %d/%d", ch.Name, id, ch.Len, ch.Cap))
+		if ch.Closed {
+			sb.WriteString(" closed")
+		}
+		sb.WriteString("\n")
+	}
+	ids = ids[:0]
+	for id := range c.Mutexes {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if m := c.Mutexes[ID(id)]; m.Locked {
+			sb.WriteString(fmt.Sprintf("  mutex %s#%d: locked by %d\n", m.Name, id, m.Holder))
+		}
+	}
+	ids = ids[:0]
+	for id := range c.RWMutexes {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if m := c.RWMutexes[ID(id)]; len(m.Readers) > 0 {
+			sb.WriteString(fmt.Sprintf("  rwmutex %s#%d: read-locked by %v\n", m.Name, id, m.Readers))
+		} else if m.Writer >= 0 {
+			sb.WriteString(fmt.Sprintf("  rwmutex %s#%d: locked by %d\n", m.Name, id, m.Writer))
+		}
+	}
+	return sb.String()
+}
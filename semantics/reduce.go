@@ -0,0 +1,621 @@
+package semantics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+)
+
+// Kind is the kind of a transition.
+type Kind int
+
+const (
+	Tau        Kind = iota // Internal step (tau, call or spawn of undefined function).
+	Branch                 // Choice of a branch of if or ifFor.
+	Call                   // Function call.
+	Spawn                  // Process creation.
+	NewChan                // Channel creation.
+	Send                   // Send to buffered channel (or closed channel).
+	Recv                   // Receive from buffered channel or closed channel.
+	Sync                   // Synchronisation of send and receive on unbuffered channel.
+	Close                  // Channel close.
+	NewMem                 // Memory creation.
+	Read                   // Memory read.
+	Write                  // Memory write.
+	NewMutex               // Mutex creation.
+	Lock                   // Mutex lock or rwmutex write lock.
+	Unlock                 // Mutex unlock or rwmutex write unlock.
+	NewRWMutex             // RWMutex creation.
+	RLock                  // RWMutex read lock.
+	RUnlock                // RWMutex read unlock.
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Tau:
+		return "tau"
+	case Branch:
+		return "branch"
+	case Call:
+		return "call"
+	case Spawn:
+		return "spawn"
+	case NewChan:
+		return "newchan"
+	case Send:
+		return "send"
+	case Recv:
+		return "recv"
+	case Sync:
+		return "sync"
+	case Close:
+		return "close"
+	case NewMem:
+		return "newmem"
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case NewMutex:
+		return "newmutex"
+	case Lock:
+		return "lock"
+	case Unlock:
+		return "unlock"
+	case NewRWMutex:
+		return "newrwmutex"
+	case RLock:
+		return "rlock"
+	case RUnlock:
+		return "runlock"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Label is the label of a transition.
+type Label struct {
+	Kind Kind
+
+	// Pids are the PIDs of the acting processes,
+	// i.e. the sender then the receiver for Sync, or a single process.
+	Pids []int
+
+	// Stmts are the acting statements of each process, i.e. the guard of
+	// the case for a select, or the if or ifFor statement for Branch.
+	Stmts []migo.Statement
+
+	// Funcs are the functions of the acting statements of each process.
+	Funcs []*migo.Function
+
+	// Cases are the branches (0 then, 1 else) of if or ifFor, or the
+	// cases of select of each process, or -1.
+	Cases []int
+
+	Res     ID     // Resource acted on or created, or -1.
+	Spawned int    // PID of the spawned process for Spawn, or -1.
+	Panic   string // Reason of panic if the transition panics, or empty.
+}
+
+func (l *Label) String() string {
+	acts := make([]string, len(l.Pids))
+	for i, pid := range l.Pids {
+		stmt := l.Stmts[i].String()
+		if i := strings.IndexAny(stmt, "\n"); i >= 0 {
+			stmt = stmt[:i]
+		}
+		acts[i] = fmt.Sprintf("%d@%s: %s", pid, l.Funcs[i].Name, stmt)
+		switch {
+		case l.Kind == Branch && l.Cases[i] == 0:
+			acts[i] += " then"
+		case l.Kind == Branch:
+			acts[i] += " else"
+		case l.Cases[i] >= 0:
+			acts[i] += fmt.Sprintf(" case %d", l.Cases[i])
+		}
+	}
+	s := fmt.Sprintf("%s [%s]", l.Kind, strings.Join(acts, " | "))
+	if l.Panic != "" {
+		s += " panic: " + l.Panic
+	}
+	return s
+}
+
+// Transition is a labelled transition between configurations.
+type Transition struct {
+	Label Label
+	Next  *Config
+}
+
+// offer is an enabled or blocked communication of a process,
+// i.e. a send or recv statement, or a guard of a select case.
+type offer struct {
+	proc *Proc
+	stmt migo.Statement // send, recv or tau (select guard)
+	res  ID
+	cas  int // case of select, or -1
+}
+
+// Successors returns the transitions enabled in configuration cfg,
+// in the order of the processes (by PID).
+func Successors(cfg *Config) []Transition {
+	if cfg.Panic != "" {
+		return nil
+	}
+	r := &reducer{cfg: cfg}
+	var offers []offer
+	for _, p := range cfg.Procs {
+		switch stmt := p.Stmt().(type) {
+		case *migo.SendStatement, *migo.RecvStatement:
+			offers = append(offers, r.offer(p, stmt, -1))
+		case *migo.SelectStatement:
+			for i, cs := range stmt.Cases {
+				if len(cs) > 0 {
+					offers = append(offers, r.offer(p, cs[0], i))
+				}
+			}
+		default:
+			r.step(p)
+		}
+	}
+	for _, o := range offers {
+		r.comm(o, offers)
+	}
+	return r.ts
+}
+
+type reducer struct {
+	cfg *Config
+	ts  []Transition
+}
+
+func (r *reducer) offer(p *Proc, stmt migo.Statement, cas int) offer {
+	o := offer{proc: p, stmt: stmt, res: -1, cas: cas}
+	switch s := stmt.(type) {
+	case *migo.SendStatement:
+		o.res = r.lookup(p, s.Chan)
+	case *migo.RecvStatement:
+		o.res = r.lookup(p, s.Chan)
+	}
+	return o
+}
+
+func (r *reducer) lookup(p *Proc, name string) ID {
+	if id, ok := r.cfg.Lookup(p, name); ok {
+		return id
+	}
+	return -1
+}
+
+// label returns a label of a transition of process p with statement stmt.
+func label(kind Kind, p *Proc, stmt migo.Statement, res ID) Label {
+	return Label{
+		Kind:    kind,
+		Pids:    []int{p.PID},
+		Stmts:   []migo.Statement{stmt},
+		Funcs:   []*migo.Function{p.Func()},
+		Cases:   []int{-1},
+		Res:     res,
+		Spawned: -1,
+	}
+}
+
+// add adds a transition with label l, where the next configuration is a
+// clone of cfg modified by next.
+func (r *reducer) add(l Label, next func(c *Config)) {
+	c := r.cfg.clone()
+	next(c)
+	if l.Panic != "" {
+		c.Panic = l.Panic
+	}
+	r.ts = append(r.ts, Transition{Label: l, Next: c})
+}
+
+// advance replaces the next statement of process pid in c (a clone)
+// by block, and returns the process.
+func advance(c *Config, pid int, block []migo.Statement) *Proc {
+	p := c.proc(pid)
+	top := p.Top()
+	top.Stmts = top.Stmts[1:]
+	if len(block) > 0 {
+		if len(top.Stmts) == 0 { // last statement of the frame
+			top.Stmts = block
+		} else {
+			p.Stack = append(p.Stack, Frame{Func: top.Func, Stmts: block, Env: top.Env, Block: true})
+		}
+	}
+	return p
+}
+
+// bind binds name to resource id in the top frame of process p.
+func bind(p *Proc, name string, id ID) {
+	top := p.Top()
+	env := make(map[string]ID, len(top.Env)+1)
+	for k, v := range top.Env {
+		env[k] = v
+	}
+	env[name] = id
+	top.Env = env
+}
+
+// step adds the transitions of process p with a non-communication statement.
+func (r *reducer) step(p *Proc) {
+	pid := p.PID
+	switch stmt := p.Stmt().(type) {
+	case *migo.TauStatement:
+		r.add(label(Tau, p, stmt, -1), func(c *Config) {
+			c.normalise(advance(c, pid, nil))
+		})
+
+	case *migo.IfStatement:
+		r.branches(p, stmt, stmt.Then, stmt.Else)
+
+	case *migo.IfForStatement:
+		r.branches(p, stmt, stmt.Then, stmt.Else)
+
+	case *migo.CallStatement:
+		fn, ok := r.cfg.prog.Function(stmt.Name)
+		if !ok {
+			r.add(label(Tau, p, stmt, -1), func(c *Config) {
+				c.normalise(advance(c, pid, nil))
+			})
+			return
+		}
+		env := r.args(p, fn, stmt.Params)
+		r.add(label(Call, p, stmt, -1), func(c *Config) {
+			q := advance(c, pid, nil)
+			for len(q.Stack) > 0 && len(q.Top().Stmts) == 0 { // tail call
+				q.Stack = q.Stack[:len(q.Stack)-1]
+			}
+			q.Stack = append(q.Stack, Frame{Func: fn, Stmts: fn.Stmts, Env: env})
+			c.normalise(q)
+		})
+
+	case *migo.SpawnStatement:
+		fn, ok := r.cfg.prog.Function(stmt.Name)
+		if !ok {
+			r.add(label(Tau, p, stmt, -1), func(c *Config) {
+				c.normalise(advance(c, pid, nil))
+			})
+			return
+		}
+		env := r.args(p, fn, stmt.Params)
+		l := label(Spawn, p, stmt, -1)
+		l.Spawned = r.cfg.freePID()
+		r.add(l, func(c *Config) {
+			c.normalise(advance(c, pid, nil))
+			child := &Proc{PID: l.Spawned, Stack: []Frame{{Func: fn, Stmts: fn.Stmts, Env: env}}}
+			c.insert(child)
+			c.normalise(child)
+		})
+
+	case *migo.NewChanStatement:
+		id := r.cfg.nextID
+		r.add(label(NewChan, p, stmt, id), func(c *Config) {
+			c.nextID++
+			c.Chans[id] = &Chan{Name: stmt.Name.Name(), Label: stmt.Chan, Cap: int(stmt.Size), Decl: stmt}
+			q := advance(c, pid, nil)
+			bind(q, stmt.Name.Name(), id)
+			c.normalise(q)
+		})
+
+	case *migo.CloseStatement:
+		id := r.lookup(p, stmt.Chan)
+		l := label(Close, p, stmt, id)
+		if ch, ok := r.cfg.Chans[id]; ok && ch.Closed {
+			l.Panic = "close of closed channel " + ch.Name
+		}
+		r.add(l, func(c *Config) {
+			if ch, ok := c.Chans[id]; ok {
+				closed := *ch
+				closed.Closed = true
+				c.Chans[id] = &closed
+			}
+			c.normalise(advance(c, pid, nil))
+		})
+
+	case *migo.NewMem:
+		id := r.cfg.nextID
+		r.add(label(NewMem, p, stmt, id), func(c *Config) {
+			c.nextID++
+			c.Mems[id] = &Mem{Name: stmt.Name}
+			q := advance(c, pid, nil)
+			bind(q, stmt.Name, id)
+			c.normalise(q)
+		})
+
+	case *migo.MemRead:
+		r.add(label(Read, p, stmt, r.lookup(p, stmt.Name)), func(c *Config) {
+			c.normalise(advance(c, pid, nil))
+		})
+
+	case *migo.MemWrite:
+		r.add(label(Write, p, stmt, r.lookup(p, stmt.Name)), func(c *Config) {
+			c.normalise(advance(c, pid, nil))
+		})
+
+	case *migo.NewSyncMutex:
+		id := r.cfg.nextID
+		r.add(label(NewMutex, p, stmt, id), func(c *Config) {
+			c.nextID++
+			c.Mutexes[id] = &Mutex{Name: stmt.Name, Holder: -1}
+			q := advance(c, pid, nil)
+			bind(q, stmt.Name, id)
+			c.normalise(q)
+		})
+
+	case *migo.SyncMutexLock:
+		r.lock(p, stmt, stmt.Name)
+
+	case *migo.SyncMutexUnlock:
+		r.unlock(p, stmt, stmt.Name)
+
+	case *migo.NewSyncRWMutex:
+		id := r.cfg.nextID
+		r.add(label(NewRWMutex, p, stmt, id), func(c *Config) {
+			c.nextID++
+			c.RWMutexes[id] = &RWMutex{Name: stmt.Name, Writer: -1}
+			q := advance(c, pid, nil)
+			bind(q, stmt.Name, id)
+			c.normalise(q)
+		})
+
+	case *migo.SyncRWMutexRLock:
+		id := r.lookup(p, stmt.Name)
+		if m, ok := r.cfg.RWMutexes[id]; ok && (m.Writer >= 0 || len(m.Readers) > 0 && r.writerWaiting(id, pid)) {
+			return // blocked
+		}
+		r.add(label(RLock, p, stmt, id), func(c *Config) {
+			if m, ok := c.RWMutexes[id]; ok {
+				c.RWMutexes[id] = &RWMutex{Name: m.Name, Readers: addReader(m.Readers, pid), Writer: m.Writer}
+			}
+			c.normalise(advance(c, pid, nil))
+		})
+
+	case *migo.SyncRWMutexRUnlock:
+		id := r.lookup(p, stmt.Name)
+		l := label(RUnlock, p, stmt, id)
+		if m, ok := r.cfg.RWMutexes[id]; ok && len(m.Readers) == 0 {
+			l.Panic = "runlock of unlocked rwmutex " + m.Name
+		}
+		r.add(l, func(c *Config) {
+			if m, ok := c.RWMutexes[id]; ok && len(m.Readers) > 0 {
+				c.RWMutexes[id] = &RWMutex{Name: m.Name, Readers: removeReader(m.Readers, pid), Writer: m.Writer}
+			}
+			c.normalise(advance(c, pid, nil))
+		})
+
+	case *migo.SyncRWMutexLock:
+		r.lock(p, stmt, stmt.Name)
+
+	case *migo.SyncRWMutexUnlock:
+		r.unlock(p, stmt, stmt.Name)
+	}
+}
+
+// lock adds the transition of lock statement stmt of process p, which locks
+// the mutex or write-locks the rwmutex bound to name by the kind of the
+// resource, as a parameter may be bound to either.
+func (r *reducer) lock(p *Proc, stmt migo.Statement, name string) {
+	pid := p.PID
+	id := r.lookup(p, name)
+	if m, ok := r.cfg.Mutexes[id]; ok && m.Locked {
+		return // blocked
+	}
+	if m, ok := r.cfg.RWMutexes[id]; ok && (m.Writer >= 0 || len(m.Readers) > 0) {
+		return // blocked
+	}
+	r.add(label(Lock, p, stmt, id), func(c *Config) {
+		if m, ok := c.Mutexes[id]; ok {
+			c.Mutexes[id] = &Mutex{Name: m.Name, Locked: true, Holder: pid}
+		}
+		if m, ok := c.RWMutexes[id]; ok {
+			c.RWMutexes[id] = &RWMutex{Name: m.Name, Writer: pid}
+		}
+		c.normalise(advance(c, pid, nil))
+	})
+}
+
+// unlock adds the transition of unlock statement stmt of process p on name,
+// which unlocks the mutex or write-unlocks the rwmutex bound to name.
+func (r *reducer) unlock(p *Proc, stmt migo.Statement, name string) {
+	pid := p.PID
+	id := r.lookup(p, name)
+	l := label(Unlock, p, stmt, id)
+	if m, ok := r.cfg.Mutexes[id]; ok && !m.Locked {
+		l.Panic = "unlock of unlocked mutex " + m.Name
+	}
+	if m, ok := r.cfg.RWMutexes[id]; ok && m.Writer < 0 {
+		l.Panic = "unlock of unlocked rwmutex " + m.Name
+	}
+	r.add(l, func(c *Config) {
+		if m, ok := c.Mutexes[id]; ok {
+			c.Mutexes[id] = &Mutex{Name: m.Name, Holder: -1}
+		}
+		if m, ok := c.RWMutexes[id]; ok {
+			c.RWMutexes[id] = &RWMutex{Name: m.Name, Readers: m.Readers, Writer: -1}
+		}
+		c.normalise(advance(c, pid, nil))
+	})
+}
+
+// writerWaiting returns true if a process other than pid is at a write lock
+// of rwmutex id, i.e. waits for the readers to release it, which blocks new
+// readers.
+func (r *reducer) writerWaiting(id ID, pid int) bool {
+	for _, q := range r.cfg.Procs {
+		var name string
+		switch stmt := q.Stmt().(type) {
+		case *migo.SyncMutexLock:
+			name = stmt.Name
+		case *migo.SyncRWMutexLock:
+			name = stmt.Name
+		default:
+			continue
+		}
+		if q.PID != pid && r.lookup(q, name) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// branches adds the transitions of the branches of if or ifFor stmt.
+func (r *reducer) branches(p *Proc, stmt migo.Statement, then, els []migo.Statement) {
+	pid := p.PID
+	for i, block := range [][]migo.Statement{then, els} {
+		block := block
+		l := label(Branch, p, stmt, -1)
+		l.Cases[0] = i
+		r.add(l, func(c *Config) {
+			c.normalise(advance(c, pid, block))
+		})
+	}
+}
+
+// args returns the environment of function fn called by process p.
+func (r *reducer) args(p *Proc, fn *migo.Function, params []*migo.Parameter) map[string]ID {
+	env := make(map[string]ID, len(params))
+	for i, param := range params {
+		if id, ok := r.cfg.Lookup(p, param.Caller.Name()); ok && i < len(fn.Params) {
+			env[fn.Params[i].Callee.Name()] = id
+		}
+	}
+	return env
+}
+
+// comm adds the transitions of offer o, where offers are all the offers.
+// Synchronisations are added for the sender only.
+func (r *reducer) comm(o offer, offers []offer) {
+	pid := o.proc.PID
+	cont := func(c *Config) *Proc { // continuation of the offer
+		if o.cas < 0 {
+			return advance(c, pid, nil)
+		}
+		sel := o.proc.Stmt().(*migo.SelectStatement)
+		return advance(c, pid, sel.Cases[o.cas][1:])
+	}
+	withCase := func(l Label) Label {
+		l.Cases[0] = o.cas
+		return l
+	}
+	ch, isChan := r.cfg.Chans[o.res]
+	switch o.stmt.(type) {
+	case *migo.SendStatement:
+		if !isChan {
+			return
+		}
+		switch {
+		case ch.Closed:
+			l := withCase(label(Send, o.proc, o.stmt, o.res))
+			l.Panic = "send on closed channel " + ch.Name
+			r.add(l, func(c *Config) { cont(c) })
+		case ch.Cap > 0:
+			if ch.Len < ch.Cap {
+				r.add(withCase(label(Send, o.proc, o.stmt, o.res)), func(c *Config) {
+					n := *ch
+					n.Len++
+					c.Chans[o.res] = &n
+					c.normalise(cont(c))
+				})
+			}
+		default:
+			for _, q := range offers {
+				if _, isRecv := q.stmt.(*migo.RecvStatement); !isRecv || q.res != o.res || q.proc.PID == pid {
+					continue
+				}
+				q := q
+				l := withCase(label(Sync, o.proc, o.stmt, o.res))
+				l.Pids = append(l.Pids, q.proc.PID)
+				l.Stmts = append(l.Stmts, q.stmt)
+				l.Funcs = append(l.Funcs, q.proc.Func())
+				l.Cases = append(l.Cases, q.cas)
+				r.add(l, func(c *Config) {
+					sender := cont(c)
+					var receiver *Proc
+					if q.cas < 0 {
+						receiver = advance(c, q.proc.PID, nil)
+					} else {
+						sel := q.proc.Stmt().(*migo.SelectStatement)
+						receiver = advance(c, q.proc.PID, sel.Cases[q.cas][1:])
+					}
+					c.normalise(sender)
+					c.normalise(receiver)
+				})
+			}
+		}
+
+	case *migo.RecvStatement:
+		if !isChan {
+			return
+		}
+		switch {
+		case ch.Len > 0:
+			r.add(withCase(label(Recv, o.proc, o.stmt, o.res)), func(c *Config) {
+				n := *ch
+				n.Len--
+				c.Chans[o.res] = &n
+				c.normalise(cont(c))
+			})
+		case ch.Closed:
+			r.add(withCase(label(Recv, o.proc, o.stmt, o.res)), func(c *Config) {
+				c.normalise(cont(c))
+			})
+		}
+
+	case *migo.TauStatement:
+		r.add(withCase(label(Tau, o.proc, o.stmt, -1)), func(c *Config) {
+			c.normalise(cont(c))
+		})
+	}
+}
+
+// freePID returns the lowest PID not used by a process.
+func (c *Config) freePID() int {
+	pid := 0
+	for _, p := range c.Procs { // sorted
+		if p.PID != pid {
+			break
+		}
+		pid++
+	}
+	return pid
+}
+
+// insert inserts process p in c (a clone), keeping the processes sorted.
+func (c *Config) insert(p *Proc) {
+	i := 0
+	for i < len(c.Procs) && c.Procs[i].PID < p.PID {
+		i++
+	}
+	c.Procs = append(c.Procs[:i:i], append([]*Proc{p}, c.Procs[i:]...)...)
+}
+
+func addReader(readers []int, pid int) []int {
+	res := make([]int, 0, len(readers)+1)
+	added := false
+	for _, r := range readers {
+		if !added && pid <= r {
+			res = append(res, pid)
+			added = true
+		}
+		res = append(res, r)
+	}
+	if !added {
+		res = append(res, pid)
+	}
+	return res
+}
+
+// removeReader removes a read lock of pid, or any read lock if pid does not
+// hold one (a read lock may be released by another process).
+func removeReader(readers []int, pid int) []int {
+	idx := 0
+	for i, r := range readers {
+		if r == pid {
+			idx = i
+			break
+		}
+	}
+	return append(readers[:idx:idx], readers[idx+1:]...)
+}
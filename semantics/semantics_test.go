@@ -0,0 +1,303 @@
+package semantics_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/parser"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+func parse(t *testing.T, s string) *migo.Program {
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return prog
+}
+
+func initial(t *testing.T, s string) *semantics.Config {
+	cfg, err := semantics.NewConfig(parse(t, s), "main")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return cfg
+}
+
+// run follows the only transition of each configuration from cfg,
+// and returns the labels and the final configuration.
+func run(t *testing.T, cfg *semantics.Config) ([]string, *semantics.Config) {
+	var labels []string
+	for i := 0; i < 100; i++ {
+		ts := semantics.Successors(cfg)
+		if len(ts) == 0 {
+			return labels, cfg
+		}
+		if len(ts) > 1 {
+			t.Fatalf("expected deterministic transition from\n%s but got %d", cfg, len(ts))
+		}
+		labels = append(labels, ts[0].Label.String())
+		cfg = ts[0].Next
+	}
+	t.Fatal("too many transitions")
+	return nil, nil
+}
+
+// reachable returns the number of reachable configurations from cfg.
+func reachable(t *testing.T, cfg *semantics.Config, bound int) int {
+	visited := map[string]bool{cfg.Key(): true}
+	queue := []*semantics.Config{cfg}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, tr := range semantics.Successors(c) {
+			if k := tr.Next.Key(); !visited[k] {
+				visited[k] = true
+				queue = append(queue, tr.Next)
+			}
+		}
+		if len(visited) > bound {
+			t.Fatalf("expected at most %d configurations", bound)
+		}
+	}
+	return len(visited)
+}
+
+func TestSync(t *testing.T) {
+	cfg := initial(t, `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch;
+def s(c): send c;`)
+	labels, final := run(t, cfg)
+	want := []string{
+		"newchan [0@main: let ch = newchan ch, 0]",
+		"spawn [0@main: spawn s(ch)]",
+		"sync [1@s: send c | 0@main: recv ch]",
+	}
+	if got := strings.Join(labels, "\n"); strings.Join(want, "\n") != got {
+		t.Errorf("expected transitions\n%s\nbut got\n%s", strings.Join(want, "\n"), got)
+	}
+	if !final.Terminated() {
+		t.Errorf("expected terminated configuration but got\n%s", final)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	cfg := initial(t, `def main(): let ch = newchan ch, 1; send ch; send ch;`)
+	labels, final := run(t, cfg)
+	if want, got := 2, len(labels); want != got {
+		t.Fatalf("expected %d transitions but got %d: %v", want, got, labels)
+	}
+	if final.Terminated() {
+		t.Fatal("expected blocked send on full channel")
+	}
+	if want, got := "send ch", final.Procs[0].Stmt().String(); want != got {
+		t.Errorf("expected blocked statement %s but got %s", want, got)
+	}
+	for _, ch := range final.Chans {
+		if want, got := 1, ch.Len; want != got {
+			t.Errorf("expected %d values in buffer but got %d", want, got)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	cfg := initial(t, `def main(): let ch = newchan ch, 0; close ch; recv ch; recv ch;`)
+	if _, final := run(t, cfg); !final.Terminated() {
+		t.Errorf("expected receive from closed channel to succeed but got\n%s", final)
+	}
+	cfg = initial(t, `def main(): let ch = newchan ch, 0; close ch; send ch; tau;`)
+	labels, final := run(t, cfg)
+	if want, got := "send on closed channel ch", final.Panic; want != got {
+		t.Errorf("expected panic %q but got %q", want, got)
+	}
+	if want, got := "send [0@main: send ch] panic: send on closed channel ch", labels[len(labels)-1]; want != got {
+		t.Errorf("expected last transition %s but got %s", want, got)
+	}
+	cfg = initial(t, `def main(): let ch = newchan ch, 0; close ch; close ch;`)
+	if _, final := run(t, cfg); final.Panic == "" {
+		t.Error("expected panic of double close")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	cfg := initial(t, `def main(): let a = newchan a, 0; let b = newchan b, 0; spawn s(b);
+  select case recv a; send a; case recv b; tau; case tau; recv a; endselect; tau;
+def s(c): send c;`)
+	for i := 0; i < 3; i++ {
+		cfg = semantics.Successors(cfg)[0].Next
+	}
+	ts := semantics.Successors(cfg)
+	var labels []string
+	for _, tr := range ts {
+		labels = append(labels, tr.Label.String())
+	}
+	want := []string{
+		"tau [0@main: tau case 2]",
+		"sync [1@s: send c | 0@main: recv b case 1]",
+	}
+	if strings.Join(want, "\n") != strings.Join(labels, "\n") {
+		t.Errorf("expected transitions\n%s\nbut got\n%s", strings.Join(want, "\n"), strings.Join(labels, "\n"))
+	}
+	if want, got := "recv a", ts[0].Next.Procs[0].Stmt().String(); want != got {
+		t.Errorf("expected continuation %s but got %s", want, got)
+	}
+	if !ts[1].Next.Procs[0].Top().Block {
+		t.Error("expected case continuation in block frame")
+	}
+}
+
+func TestBranch(t *testing.T) {
+	cfg := initial(t, `def main(): if send a; else recv a; endif; tau;`)
+	ts := semantics.Successors(cfg)
+	if want, got := 2, len(ts); want != got {
+		t.Fatalf("expected %d transitions but got %d", want, got)
+	}
+	for i, want := range []string{"send a", "recv a"} {
+		if got := ts[i].Next.Procs[0].Stmt().String(); want != got {
+			t.Errorf("branch %d: expected %s but got %s", i, want, got)
+		}
+		if want, got := 2, len(ts[i].Next.Procs[0].Stack); want != got {
+			t.Errorf("branch %d: expected %d frames but got %d", i, want, got)
+		}
+	}
+}
+
+func TestMutex(t *testing.T) {
+	cfg := initial(t, `def main(): letsync m mutex; lock m; spawn f(m); unlock m;
+def f(m): lock m; unlock m;`)
+	for i := 0; i < 3; i++ {
+		cfg = semantics.Successors(cfg)[0].Next
+	}
+	ts := semantics.Successors(cfg)
+	if want, got := 1, len(ts); want != got {
+		t.Fatalf("expected %d transition (lock blocked) but got %d", want, got)
+	}
+	if want, got := "unlock [0@main: unlock m]", ts[0].Label.String(); want != got {
+		t.Errorf("expected %s but got %s", want, got)
+	}
+	if _, final := run(t, ts[0].Next); !final.Terminated() {
+		t.Errorf("expected terminated configuration but got\n%s", final)
+	}
+	cfg = initial(t, `def main(): letsync m mutex; unlock m;`)
+	if _, final := run(t, cfg); final.Panic == "" {
+		t.Error("expected panic of unlock of unlocked mutex")
+	}
+}
+
+func TestRWMutex(t *testing.T) {
+	cfg := initial(t, `def main(): letsync m rwmutex; rlock m; spawn f(m); runlock m;
+def f(m): rlock m; runlock m;`)
+	// main and f hold read locks at the same time.
+	for i := 0; i < 3; i++ {
+		cfg = semantics.Successors(cfg)[0].Next
+	}
+	ts := semantics.Successors(cfg)
+	if want, got := "rlock [1@f: rlock m]", ts[len(ts)-1].Label.String(); want != got {
+		t.Fatalf("expected %s but got %s", want, got)
+	}
+	cfg = ts[len(ts)-1].Next
+	for _, m := range cfg.RWMutexes {
+		if want, got := "[0 1]", fmt.Sprint(m.Readers); want != got {
+			t.Errorf("expected readers %s but got %s", want, got)
+		}
+	}
+	cfg = initial(t, `def main(): letsync m rwmutex; runlock m;`)
+	if _, final := run(t, cfg); final.Panic == "" {
+		t.Error("expected panic of runlock of unlocked rwmutex")
+	}
+}
+
+func TestRWMutexWriter(t *testing.T) {
+	// Upgrade of a read lock blocks forever.
+	cfg := initial(t, `def main(): letsync m rwmutex; rlock m; lock m; unlock m; runlock m;`)
+	if labels, final := run(t, cfg); len(final.Procs) != 1 || len(labels) != 2 {
+		t.Errorf("expected main blocked at lock m but got %v", labels)
+	}
+	// A waiting writer blocks new readers.
+	cfg = initial(t, `def main(): letsync m rwmutex; rlock m; spawn f(m); tau; rlock m; runlock m; runlock m;
+def f(m): lock m; unlock m;`)
+	for i := 0; i < 3; i++ {
+		cfg = semantics.Successors(cfg)[0].Next
+	}
+	ts := semantics.Successors(cfg)
+	if want, got := 1, len(ts); want != got {
+		t.Fatalf("expected %d transition but got %d", want, got)
+	}
+	if want, got := "tau [0@main: tau]", ts[0].Label.String(); want != got {
+		t.Fatalf("expected %s but got %s", want, got)
+	}
+	if ts := semantics.Successors(ts[0].Next); len(ts) != 0 {
+		t.Errorf("expected deadlock but got %s", ts[0].Label.String())
+	}
+	cfg = initial(t, `def main(): letsync m rwmutex; lock m; spawn f(m); unlock m;
+def f(m): rlock m; runlock m;`)
+	cfg = semantics.Successors(semantics.Successors(cfg)[0].Next)[0].Next
+	for _, m := range cfg.RWMutexes {
+		if want, got := 0, m.Writer; want != got {
+			t.Errorf("expected writer %d but got %d", want, got)
+		}
+	}
+	cfg = initial(t, `def main(): letsync m rwmutex; unlock m;`)
+	if _, final := run(t, cfg); final.Panic == "" {
+		t.Error("expected panic of unlock of unlocked rwmutex")
+	}
+}
+
+// Recursive loops must have finitely many configurations.
+func TestRecursion(t *testing.T) {
+	cfg := initial(t, `def main(): let ch = newchan ch, 0; spawn s(ch); call r(ch);
+def r(c): recv c; call r(c);
+def s(c): let d = newchan d, 1; send c; call s(c);`)
+	if n := reachable(t, cfg, 100); n > 10 {
+		t.Errorf("expected few configurations but got %d", n)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	cfg := initial(t, `def main(): spawn f(); recv x; lock m;
+def f(): send x; write v;`)
+	if want, got := 3, len(cfg.Globals); want != got {
+		t.Errorf("expected %d globals but got %d", want, got)
+	}
+	if _, ok := cfg.Mutexes[cfg.Globals["m"]]; !ok {
+		t.Error("expected global m to be a mutex")
+	}
+	if _, ok := cfg.Mems[cfg.Globals["v"]]; !ok {
+		t.Error("expected global v to be a memory location")
+	}
+	for ts := semantics.Successors(cfg); len(ts) > 0; ts = semantics.Successors(cfg) {
+		cfg = ts[0].Next
+	}
+	if !cfg.Terminated() {
+		t.Errorf("expected terminated configuration but got\n%s", cfg)
+	}
+}
+
+type custom struct{}
+
+func (custom) String() string               { return "custom" }
+func (custom) Children() [][]migo.Statement { return nil }
+func (custom) IsTau() bool                  { return true }
+
+func TestNewConfigErrors(t *testing.T) {
+	prog := parse(t, `def main(): call f(a); def f(): tau;`)
+	if _, err := semantics.NewConfig(prog, "main"); err == nil {
+		t.Error("expected arity error")
+	} else if _, ok := err.(*semantics.ErrArity); !ok {
+		t.Errorf("expected ErrArity but got %T", err)
+	}
+	if _, err := semantics.NewConfig(prog, "nomain"); err == nil {
+		t.Error("expected error for missing entry")
+	}
+	prog = parse(t, `def main(): tau;`)
+	fn, _ := prog.Function("main")
+	fn.AddStmts(custom{})
+	if _, err := semantics.NewConfig(prog, "main"); err == nil {
+		t.Error("expected unknown statement error")
+	} else if _, ok := err.(*migo.ErrUnknownStatement); !ok {
+		t.Errorf("expected ErrUnknownStatement but got %T", err)
+	}
+}
@@ -0,0 +1,335 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+// ErrEnd is the error if there is no step left in the execution to replay.
+var ErrEnd = errors.New("end of execution")
+
+// ErrMismatch is the error if a step of the execution to replay is not
+// enabled in the current configuration, i.e. the transition of its choice
+// has another label, or no enabled transition has its label if the step
+// has no choice.
+type ErrMismatch struct {
+	Step    int      // Index of the step in the execution.
+	Label   string   // Label of the step.
+	Enabled []string // Labels of the enabled transitions.
+}
+
+func (e *ErrMismatch) Error() string {
+	return fmt.Sprintf("step %d: %s is not enabled (enabled: %s)", e.Step+1, e.Label, strings.Join(e.Enabled, "; "))
+}
+
+// ErrEntry is the error if the entry function of a trace is not the entry
+// function of the debugger.
+type ErrEntry struct {
+	Entry, Trace string
+}
+
+func (e *ErrEntry) Error() string {
+	return fmt.Sprintf("trace of entry %s cannot be replayed from %s", e.Trace, e.Entry)
+}
+
+// Debugger replays an execution of a program step by step.
+//
+// The execution is loaded from a Trace of Run (e.g. decoded from JSON) or
+// the labels of a counterexample of package check. A step of a Trace is
+// replayed by its Choice, and its label is checked against the transition
+// taken; a label of a counterexample is matched to the first enabled
+// transition with the label. The enabled transitions can also be taken
+// manually, which discards the rest of the execution if it diverges.
+//
+// Breakpoints are names of functions or resources: Continue stops after a
+// step executing a statement of a function, calling or spawning a function,
+// or using a resource (by its name when created) with the name of a
+// breakpoint.
+type Debugger struct {
+	prog   *migo.Program
+	entry  string
+	stmts  *statements
+	cfg    *semantics.Config
+	steps  []Step          // steps taken
+	last   semantics.Label // label of the last step
+	script []scriptStep    // execution to replay
+	next   int             // index of the next step in script
+	breaks map[string]bool
+}
+
+// scriptStep is a step of the execution to replay.
+type scriptStep struct {
+	choice int // index of the transition, or -1 to match by label
+	label  string
+}
+
+// match returns true if the i-th transition of ts is the step.
+func (s scriptStep) match(ts []semantics.Transition, i int) bool {
+	return (s.choice < 0 || s.choice == i) && ts[i].Label.String() == s.label
+}
+
+// NewDebugger returns a Debugger of Program prog from function entry,
+// with no execution to replay.
+func NewDebugger(prog *migo.Program, entry string) (*Debugger, error) {
+	cfg, err := semantics.NewConfig(prog, entry)
+	if err != nil {
+		return nil, err
+	}
+	return &Debugger{
+		prog:   prog,
+		entry:  entry,
+		stmts:  newStatements(prog),
+		cfg:    cfg,
+		breaks: make(map[string]bool),
+	}, nil
+}
+
+// LoadTrace restarts d with the execution of trace t.
+func (d *Debugger) LoadTrace(t *Trace) error {
+	if t.Entry != d.entry {
+		return &ErrEntry{Entry: d.entry, Trace: t.Entry}
+	}
+	script := make([]scriptStep, len(t.Steps))
+	for i, s := range t.Steps {
+		script[i] = scriptStep{choice: s.Choice, label: s.Label}
+	}
+	d.Restart()
+	d.script = script
+	return nil
+}
+
+// LoadLabels restarts d with the execution of the transitions labels,
+// e.g. a check.Trace.
+func (d *Debugger) LoadLabels(labels []semantics.Label) {
+	script := make([]scriptStep, len(labels))
+	for i, l := range labels {
+		script[i] = scriptStep{choice: -1, label: l.String()}
+	}
+	d.Restart()
+	d.script = script
+}
+
+// Restart returns to the initial configuration, keeping the execution to
+// replay and the breakpoints.
+func (d *Debugger) Restart() {
+	d.cfg, _ = semantics.NewConfig(d.prog, d.entry) // checked by NewDebugger
+	d.steps = nil
+	d.next = 0
+}
+
+// Config returns the current configuration.
+func (d *Debugger) Config() *semantics.Config {
+	return d.cfg
+}
+
+// Steps returns the steps taken from the initial configuration.
+func (d *Debugger) Steps() []Step {
+	return d.steps
+}
+
+// Remaining returns the number of steps left in the execution to replay.
+func (d *Debugger) Remaining() int {
+	return len(d.script) - d.next
+}
+
+// Enabled returns the transitions enabled in the current configuration.
+func (d *Debugger) Enabled() []semantics.Transition {
+	return semantics.Successors(d.cfg)
+}
+
+// Take takes the i-th enabled transition.
+func (d *Debugger) Take(i int) (Step, error) {
+	ts := d.Enabled()
+	if i < 0 || i >= len(ts) {
+		return Step{}, fmt.Errorf("no enabled transition %d (%d enabled)", i, len(ts))
+	}
+	if d.next < len(d.script) && d.script[d.next].match(ts, i) {
+		d.next++
+	} else {
+		d.script = d.script[:d.next] // diverged
+	}
+	return d.take(ts, i), nil
+}
+
+func (d *Debugger) take(ts []semantics.Transition, i int) Step {
+	s := newStep(d.stmts, d.cfg, ts[i].Label, i)
+	d.steps = append(d.steps, s)
+	d.last = ts[i].Label
+	d.cfg = ts[i].Next
+	return s
+}
+
+// Step takes the next step of the execution to replay.
+func (d *Debugger) Step() (Step, error) {
+	if d.next >= len(d.script) {
+		return Step{}, ErrEnd
+	}
+	ts := d.Enabled()
+	s := d.script[d.next]
+	if s.choice >= 0 && s.choice < len(ts) && s.match(ts, s.choice) {
+		d.next++
+		return d.take(ts, s.choice), nil
+	}
+	enabled := make([]string, len(ts))
+	for i, t := range ts {
+		enabled[i] = t.Label.String()
+		if s.choice < 0 && s.match(ts, i) {
+			d.next++
+			return d.take(ts, i), nil
+		}
+	}
+	return Step{}, &ErrMismatch{Step: d.next, Label: s.label, Enabled: enabled}
+}
+
+// Continue takes the steps of the execution to replay until a step hits a
+// breakpoint, and returns the steps taken. The error is ErrEnd if the end
+// of the execution is reached without hitting a breakpoint.
+func (d *Debugger) Continue() ([]Step, error) {
+	var steps []Step
+	for {
+		s, err := d.Step()
+		if err != nil {
+			return steps, err
+		}
+		steps = append(steps, s)
+		if d.hit(s) {
+			return steps, nil
+		}
+	}
+}
+
+// Break sets a breakpoint on the function or resource name.
+func (d *Debugger) Break(name string) {
+	d.breaks[name] = true
+}
+
+// Clear removes the breakpoint on name.
+func (d *Debugger) Clear(name string) {
+	delete(d.breaks, name)
+}
+
+// Breakpoints returns the breakpoints, sorted.
+func (d *Debugger) Breakpoints() []string {
+	names := make([]string, 0, len(d.breaks))
+	for name := range d.breaks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hit returns true if step s, the last step, hits a breakpoint.
+func (d *Debugger) hit(s Step) bool {
+	if d.breaks[s.Resource] {
+		return true
+	}
+	for _, fn := range s.Funcs {
+		if d.breaks[fn] {
+			return true
+		}
+	}
+	switch stmt := d.last.Stmts[0].(type) {
+	case *migo.CallStatement:
+		return d.breaks[stmt.Name]
+	case *migo.SpawnStatement:
+		return d.breaks[stmt.Name]
+	}
+	return false
+}
+
+// Goroutine is the state of a process.
+type Goroutine struct {
+	PID   int
+	Stack []string // Functions of the frames, outermost first.
+	Pos   string   // Position of the next statement, e.g. main:2.
+	Stmt  migo.Statement
+}
+
+func (g Goroutine) String() string {
+	return fmt.Sprintf("%d@%s: %s (%s)", g.PID, g.Stack[len(g.Stack)-1], firstLine(g.Stmt), g.Pos)
+}
+
+// Goroutines returns the processes of the current configuration.
+func (d *Debugger) Goroutines() []Goroutine {
+	gs := make([]Goroutine, len(d.cfg.Procs))
+	for i, p := range d.cfg.Procs {
+		g := Goroutine{PID: p.PID, Pos: d.stmts.pos[&p.Top().Stmts[0]], Stmt: p.Stmt()}
+		for _, f := range p.Stack {
+			if !f.Block {
+				g.Stack = append(g.Stack, f.Func.Name)
+			}
+		}
+		if len(g.Stack) == 0 {
+			g.Stack = []string{p.Func().Name}
+		}
+		gs[i] = g
+	}
+	return gs
+}
+
+// String returns the current configuration: the processes, the buffers of
+// the channels and the owners of the locks.
+func (d *Debugger) String() string {
+	var sb strings.Builder
+	c := d.cfg
+	switch {
+	case c.Panic != "":
+		sb.WriteString(fmt.Sprintf("panic: %s\n", c.Panic))
+	case c.Terminated():
+		sb.WriteString("terminated\n")
+	case len(d.Enabled()) == 0:
+		sb.WriteString("blocked\n")
+	}
+	for _, g := range d.Goroutines() {
+		sb.WriteString(fmt.Sprintf("  %s\n", g))
+	}
+	var chans, mutexes, rwmutexes []semantics.ID
+	for id := range c.Chans {
+		chans = append(chans, id)
+	}
+	for id := range c.Mutexes {
+		mutexes = append(mutexes, id)
+	}
+	for id := range c.RWMutexes {
+		rwmutexes = append(rwmutexes, id)
+	}
+	for _, id := range sortIDs(chans) {
+		ch := c.Chans[id]
+		sb.WriteString(fmt.Sprintf("  chan %s#%d: %d/%d", ch.Name, id, ch.Len, ch.Cap))
+		if ch.Closed {
+			sb.WriteString(" closed")
+		}
+		sb.WriteString("\n")
+	}
+	for _, id := range sortIDs(mutexes) {
+		m := c.Mutexes[id]
+		owner := "unlocked"
+		if m.Locked {
+			owner = fmt.Sprintf("locked by %d", m.Holder)
+		}
+		sb.WriteString(fmt.Sprintf("  mutex %s#%d: %s\n", m.Name, id, owner))
+	}
+	for _, id := range sortIDs(rwmutexes) {
+		m := c.RWMutexes[id]
+		owner := "unlocked"
+		switch {
+		case m.Writer >= 0:
+			owner = fmt.Sprintf("locked by %d", m.Writer)
+		case len(m.Readers) > 0:
+			owner = fmt.Sprintf("read-locked by %v", m.Readers)
+		}
+		sb.WriteString(fmt.Sprintf("  rwmutex %s#%d: %s\n", m.Name, id, owner))
+	}
+	return sb.String()
+}
+
+// sortIDs sorts ids in place and returns them.
+func sortIDs(ids []semantics.ID) []semantics.ID {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
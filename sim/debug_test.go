@@ -0,0 +1,181 @@
+package sim_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nickng/migo/v3/check"
+	"github.com/nickng/migo/v3/sim"
+)
+
+// A trace exported as JSON is replayed to the same configuration.
+func TestReplayTrace(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 1; spawn s(ch); spawn s(ch); call r(ch);
+def r(c): select case recv c; call r(c); case tau; endselect;
+def s(c): if send c; else close c; endif;`)
+	for seed := int64(0); seed < 10; seed++ {
+		tr, err := sim.Run(prog, sim.Options{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded sim.Trace
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		d, err := sim.NewDebugger(prog, "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.LoadTrace(&decoded); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Continue(); err != sim.ErrEnd {
+			t.Fatalf("expected end of execution but got %v", err)
+		}
+		if want, got := tr.Final.Key(), d.Config().Key(); want != got {
+			t.Errorf("expected final configuration\n%s\nbut got\n%s", tr.Final, d.Config())
+		}
+		if want, got := len(tr.Steps), len(d.Steps()); want != got {
+			t.Errorf("expected %d steps but got %d", want, got)
+		}
+	}
+}
+
+// A deadlock found by check is replayed with breakpoints.
+func TestReplayDeadlock(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 1; letsync m mutex; spawn f(ch, m); lock m; send ch; send ch; send ch; unlock m;
+def f(c, m): recv c; lock m; unlock m;`)
+	res, err := check.Deadlocks(prog, check.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(res.Deadlocks); want != got {
+		t.Fatalf("expected %d deadlock but got %d", want, got)
+	}
+	d, err := sim.NewDebugger(prog, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.LoadLabels(res.Deadlocks[0].Trace)
+	d.Break("f")
+	steps, err := d.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "spawn [0@main: spawn f(ch, m)]", steps[len(steps)-1].Label; want != got {
+		t.Errorf("expected break at %s but got %s", want, got)
+	}
+	d.Clear("f")
+	d.Break("ch")
+	steps, err = d.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "main:5", steps[len(steps)-1].Stmts[0]; want != got {
+		t.Errorf("expected break at %s but got %s", want, got)
+	}
+	d.Clear("ch")
+	if _, err := d.Continue(); err != sim.ErrEnd {
+		t.Fatalf("expected end of execution but got %v", err)
+	}
+	want := `blocked
+  0@main: send ch (main:7)
+  1@f: lock m (f:2)
+  chan ch#0: 1/1
+  mutex m#1: locked by 0
+`
+	if got := d.String(); want != got {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch;
+def s(c): send c;`)
+	tr, err := sim.Run(prog, sim.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := sim.NewDebugger(prog, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.LoadTrace(tr); err != nil {
+		t.Fatal(err)
+	}
+	// Taking a transition of the execution keeps the rest.
+	if _, err := d.Take(0); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, d.Remaining(); want != got {
+		t.Errorf("expected %d remaining steps but got %d", want, got)
+	}
+	if _, err := d.Take(1); err == nil {
+		t.Error("expected error of disabled transition")
+	}
+	tr.Steps[0].Label = "tau [0@main: tau]"
+	if err := d.LoadTrace(tr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Step(); err == nil {
+		t.Error("expected mismatch of step")
+	}
+	// Taking another transition discards the rest.
+	if _, err := d.Take(0); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, d.Remaining(); want != got {
+		t.Errorf("expected %d remaining steps but got %d", want, got)
+	}
+	tr.Entry = "nomain"
+	if err := d.LoadTrace(tr); err == nil {
+		t.Error("expected error of trace entry")
+	}
+}
+
+// A step of a trace is replayed by its choice, and its label is checked.
+func TestReplayChoice(t *testing.T) {
+	prog := parse(t, `def main(): spawn f(); spawn f();
+def f(): tau;`)
+	tr := &sim.Trace{Entry: "main", Steps: []sim.Step{
+		{Choice: 0, Label: "spawn [0@main: spawn f()]"},
+		{Choice: 0, Label: "spawn [0@main: spawn f()]"},
+		{Choice: 1, Label: "tau [2@f: tau]"},
+		{Choice: 0, Label: "tau [1@f: tau]"},
+	}}
+	d, err := sim.NewDebugger(prog, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.LoadTrace(tr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Continue(); err != sim.ErrEnd {
+		t.Fatalf("expected end of execution but got %v", err)
+	}
+	if !d.Config().Terminated() {
+		t.Errorf("expected terminated configuration but got\n%s", d)
+	}
+	// The transition of the choice has another label.
+	tr.Steps[2].Choice = 0
+	if err := d.LoadTrace(tr); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := d.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mismatch *sim.ErrMismatch
+	if _, err := d.Step(); !errors.As(err, &mismatch) {
+		t.Fatalf("expected mismatch of step but got %v", err)
+	}
+	if want, got := 2, mismatch.Step; want != got {
+		t.Errorf("expected mismatch at step %d but got %d", want, got)
+	}
+}
@@ -0,0 +1,282 @@
+// Package sim simulates MiGo programs by random executions of the operational
+// semantics (see package semantics).
+//
+// Run executes a program from its entry function, picking one of the enabled
+// transitions at random at each step, until the program terminates, blocks
+// or panics (or a bound on the number of steps is reached), and records the
+// execution as a Trace, which can be exported as JSON for replay. Cover runs
+// a program repeatedly and counts the runs executing each statement.
+//
+// A Debugger replays a Trace, or a counterexample of package check, step by
+// step with breakpoints.
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/check"
+	"github.com/nickng/migo/v3/semantics"
+)
+
+// DefaultMaxSteps is the default bound on the number of steps of a run.
+const DefaultMaxSteps = 10000
+
+// Options is the options of a simulation.
+type Options struct {
+	Entry    string // Entry function, default "main".
+	Seed     int64  // Seed of the random choices.
+	MaxSteps int    // Bound on the number of steps, default DefaultMaxSteps.
+}
+
+func (o Options) entry() string {
+	if o.Entry == "" {
+		return "main"
+	}
+	return o.Entry
+}
+
+func (o Options) maxSteps() int {
+	if o.MaxSteps <= 0 {
+		return DefaultMaxSteps
+	}
+	return o.MaxSteps
+}
+
+// Outcome is the end of a run.
+type Outcome string
+
+const (
+	Terminated Outcome = "terminated" // All processes terminated.
+	Blocked    Outcome = "blocked"    // No transition enabled (deadlock).
+	Panicked   Outcome = "panic"      // The program panicked.
+	StepLimit  Outcome = "limit"      // The bound on the number of steps is reached.
+)
+
+// Step is a transition of a run.
+type Step struct {
+	// Choice is the index of the transition in semantics.Successors of the
+	// configuration, which identifies the transition for replay.
+	Choice int `json:"choice"`
+
+	Kind     string   `json:"kind"`
+	Pids     []int    `json:"pids"`               // PIDs of the acting processes.
+	Funcs    []string `json:"funcs"`              // Functions of the acting processes.
+	Stmts    []string `json:"stmts"`              // Positions of the statements, e.g. main:2.
+	Resource string   `json:"resource,omitempty"` // Channel (or other resource) of the statements.
+	Label    string   `json:"label"`
+}
+
+// Trace is the record of a run.
+type Trace struct {
+	Entry   string   `json:"entry"`
+	Seed    int64    `json:"seed"`
+	Steps   []Step   `json:"steps"`
+	Outcome Outcome  `json:"outcome"`
+	Blocked []string `json:"blocked,omitempty"` // Processes left, if blocked or at the step limit.
+	Panic   string   `json:"panic,omitempty"`
+
+	Final *semantics.Config `json:"-"` // Final configuration.
+
+	executed []*migo.Statement // slots of the statements executed
+}
+
+func (t *Trace) String() string {
+	var sb strings.Builder
+	for i, s := range t.Steps {
+		sb.WriteString(fmt.Sprintf("  %d. %s\n", i+1, s.Label))
+	}
+	sb.WriteString(string(t.Outcome))
+	switch {
+	case t.Panic != "":
+		sb.WriteString(": " + t.Panic)
+	case len(t.Blocked) > 0:
+		sb.WriteString(": " + strings.Join(t.Blocked, ", "))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Run executes Program prog with random choices from opts.Seed.
+func Run(prog *migo.Program, opts Options) (*Trace, error) {
+	cfg, err := semantics.NewConfig(prog, opts.entry())
+	if err != nil {
+		return nil, err
+	}
+	stmts := newStatements(prog)
+	rng := rand.New(rand.NewSource(opts.Seed))
+	t := &Trace{Entry: opts.entry(), Seed: opts.Seed, Outcome: StepLimit, Steps: []Step{}}
+	for len(t.Steps) < opts.maxSteps() {
+		ts := semantics.Successors(cfg)
+		if len(ts) == 0 {
+			break
+		}
+		i := rng.Intn(len(ts))
+		t.Steps = append(t.Steps, newStep(stmts, cfg, ts[i].Label, i))
+		for j := range ts[i].Label.Pids {
+			t.executed = append(t.executed, stmts.executed(cfg, ts[i].Label, j)...)
+		}
+		cfg = ts[i].Next
+	}
+	t.end(cfg)
+	return t, nil
+}
+
+// newStep returns the Step of transition l from configuration cfg, which is
+// the transition at index choice in semantics.Successors of cfg.
+func newStep(stmts *statements, cfg *semantics.Config, l semantics.Label, choice int) Step {
+	s := Step{Choice: choice, Kind: l.Kind.String(), Pids: l.Pids, Label: l.String()}
+	for i, fn := range l.Funcs {
+		s.Funcs = append(s.Funcs, fn.Name)
+		slots := stmts.executed(cfg, l, i)
+		s.Stmts = append(s.Stmts, stmts.pos[slots[len(slots)-1]])
+	}
+	if l.Res >= 0 {
+		s.Resource = cfg.ResourceName(l.Res)
+	}
+	return s
+}
+
+// end sets the outcome of t from its final configuration cfg.
+func (t *Trace) end(cfg *semantics.Config) {
+	t.Final = cfg
+	switch {
+	case cfg.Panic != "":
+		t.Outcome, t.Panic = Panicked, cfg.Panic
+		return
+	case cfg.Terminated():
+		t.Outcome = Terminated
+		return
+	case len(semantics.Successors(cfg)) == 0:
+		t.Outcome = Blocked
+	}
+	for _, p := range cfg.Procs {
+		t.Blocked = append(t.Blocked, check.Blocked{PID: p.PID, Func: p.Func(), Stmt: p.Stmt()}.String())
+	}
+}
+
+// Coverage is the statistics of repeated runs.
+type Coverage struct {
+	Runs     int
+	Outcomes map[Outcome]int  // Number of runs by outcome.
+	Stmts    []migo.Statement // Statements of the program in order.
+	Pos      []string         // Positions of the statements, e.g. main:2.
+	Counts   []int            // Number of runs executing each statement.
+}
+
+// Cover runs Program prog n times, with seeds opts.Seed, opts.Seed+1, ...
+func Cover(prog *migo.Program, opts Options, n int) (*Coverage, error) {
+	c := &Coverage{Runs: n, Outcomes: make(map[Outcome]int)}
+	stmts := newStatements(prog)
+	index := make(map[*migo.Statement]int)
+	for _, slot := range stmts.slots {
+		index[slot] = len(c.Stmts)
+		c.Stmts = append(c.Stmts, *slot)
+		c.Pos = append(c.Pos, stmts.pos[slot])
+	}
+	c.Counts = make([]int, len(c.Stmts))
+	for i := 0; i < n; i++ {
+		o := opts
+		o.Seed = opts.Seed + int64(i)
+		t, err := Run(prog, o)
+		if err != nil {
+			return nil, err
+		}
+		c.Outcomes[t.Outcome]++
+		executed := make(map[int]bool)
+		for _, slot := range t.executed {
+			if j, ok := index[slot]; ok && !executed[j] {
+				executed[j] = true
+				c.Counts[j]++
+			}
+		}
+	}
+	return c, nil
+}
+
+// Uncovered returns the positions of the statements not executed by any run.
+func (c *Coverage) Uncovered() []string {
+	var pos []string
+	for i := range c.Stmts {
+		if c.Counts[i] == 0 {
+			pos = append(pos, c.Pos[i])
+		}
+	}
+	return pos
+}
+
+func (c *Coverage) String() string {
+	var sb strings.Builder
+	outcomes := make([]string, 0, len(c.Outcomes))
+	for o, n := range c.Outcomes {
+		outcomes = append(outcomes, fmt.Sprintf("%s: %d", o, n))
+	}
+	sort.Strings(outcomes)
+	sb.WriteString(fmt.Sprintf("%d runs (%s)\n", c.Runs, strings.Join(outcomes, ", ")))
+	for i, stmt := range c.Stmts {
+		sb.WriteString(fmt.Sprintf("  %-16s %d/%d  %s\n", c.Pos[i], c.Counts[i], c.Runs, firstLine(stmt)))
+	}
+	return sb.String()
+}
+
+// statements is the statements of a program, identified by their slot in
+// the blocks of the program (statements are not necessarily distinct
+// values, e.g. tau statements).
+type statements struct {
+	slots []*migo.Statement          // in program order
+	pos   map[*migo.Statement]string // positions in the style of check.Op.Pos
+}
+
+func newStatements(prog *migo.Program) *statements {
+	s := &statements{pos: make(map[*migo.Statement]string)}
+	for _, fn := range prog.Funcs {
+		s.add(fn.Stmts, fn.Name+":")
+	}
+	return s
+}
+
+func (s *statements) add(stmts []migo.Statement, prefix string) {
+	for i := range stmts {
+		pos := fmt.Sprintf("%s%d", prefix, i+1)
+		s.slots = append(s.slots, &stmts[i])
+		s.pos[&stmts[i]] = pos
+		switch stmt := stmts[i].(type) {
+		case *migo.IfStatement:
+			s.add(stmt.Then, pos+"/then:")
+			s.add(stmt.Else, pos+"/else:")
+		case *migo.IfForStatement:
+			s.add(stmt.Then, pos+"/then:")
+			s.add(stmt.Else, pos+"/else:")
+		case *migo.SelectStatement:
+			for j := range stmt.Cases {
+				s.add(stmt.Cases[j], fmt.Sprintf("%s/case%d:", pos, j+1))
+			}
+		}
+	}
+}
+
+// executed returns the slots of the statements executed by the i-th
+// process of transition l from configuration cfg: the next statement of the
+// process, followed by the guard of the case of a select.
+func (s *statements) executed(cfg *semantics.Config, l semantics.Label, i int) []*migo.Statement {
+	p, ok := cfg.Proc(l.Pids[i])
+	if !ok {
+		return nil
+	}
+	slots := []*migo.Statement{&p.Top().Stmts[0]}
+	if sel, ok := p.Stmt().(*migo.SelectStatement); ok && l.Cases[i] >= 0 {
+		slots = append(slots, &sel.Cases[l.Cases[i]][0])
+	}
+	return slots
+}
+
+func firstLine(stmt migo.Statement) string {
+	str := stmt.String()
+	if i := strings.IndexByte(str, '\n'); i >= 0 {
+		return str[:i]
+	}
+	return str
+}
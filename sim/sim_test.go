@@ -0,0 +1,146 @@
+package sim_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nickng/migo/v3"
+	"github.com/nickng/migo/v3/parser"
+	"github.com/nickng/migo/v3/sim"
+)
+
+func parse(t *testing.T, s string) *migo.Program {
+	prog, err := parser.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return prog
+}
+
+func TestOutcomes(t *testing.T) {
+	tests := []struct {
+		name    string
+		prog    string
+		outcome sim.Outcome
+		blocked string
+	}{
+		{
+			name: "terminated",
+			prog: `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch;
+def s(c): send c;`,
+			outcome: sim.Terminated,
+		},
+		{
+			name:    "blocked",
+			prog:    `def main(): let ch = newchan ch, 0; recv ch;`,
+			outcome: sim.Blocked,
+			blocked: "0@main: recv ch",
+		},
+		{
+			name:    "panic",
+			prog:    `def main(): let ch = newchan ch, 0; close ch; send ch;`,
+			outcome: sim.Panicked,
+		},
+		{
+			name:    "limit",
+			prog:    `def main(): tau; call main();`,
+			outcome: sim.StepLimit,
+			blocked: "0@main: tau",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr, err := sim.Run(parse(t, test.prog), sim.Options{MaxSteps: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := test.outcome, tr.Outcome; want != got {
+				t.Errorf("expected outcome %s but got %s\n%s", want, got, tr)
+			}
+			if want, got := test.blocked, strings.Join(tr.Blocked, ", "); want != got {
+				t.Errorf("expected blocked %q but got %q", want, got)
+			}
+		})
+	}
+}
+
+// Runs with the same seed are the same.
+func TestSeed(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 0; spawn s(ch); spawn s(ch); call r(ch);
+def r(c): select case recv c; call r(c); case tau; endselect;
+def s(c): if send c; else tau; endif;`)
+	traces := make(map[string]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		t1, err := sim.Run(prog, sim.Options{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t2, err := sim.Run(prog, sim.Options{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if t1.String() != t2.String() {
+			t.Errorf("expected same traces with seed %d but got\n%s\nand\n%s", seed, t1, t2)
+		}
+		traces[t1.String()] = true
+	}
+	if len(traces) < 2 {
+		t.Error("expected different traces with different seeds")
+	}
+}
+
+func TestTraceJSON(t *testing.T) {
+	prog := parse(t, `def main(): let ch = newchan ch, 0; spawn s(ch); recv ch;
+def s(c): send c;`)
+	tr, err := sim.Run(prog, sim.Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded sim.Trace
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tr.Steps, decoded.Steps) {
+		t.Errorf("expected steps %v but got %v", tr.Steps, decoded.Steps)
+	}
+	last := decoded.Steps[len(decoded.Steps)-1]
+	if want, got := `{"choice":0,"kind":"sync","pids":[1,0],"funcs":["s","main"],"stmts":["s:1","main:3"],"resource":"ch","label":"sync [1@s: send c | 0@main: recv ch]"}`, mustMarshal(t, last); want != got {
+		t.Errorf("expected step\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCover(t *testing.T) {
+	prog := parse(t, `def main(): if tau; else read x; endif;
+def unused(): tau;`)
+	c, err := sim.Cover(prog, sim.Options{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 20, c.Outcomes[sim.Terminated]; want != got {
+		t.Errorf("expected %d runs but got %d", want, got)
+	}
+	if want, got := "unused:1", strings.Join(c.Uncovered(), ", "); want != got {
+		t.Errorf("expected uncovered %s but got %s\n%s", want, got, c)
+	}
+	if want, got := 20, c.Counts[0]; want != got {
+		t.Errorf("expected if executed in %d runs but got %d", want, got)
+	}
+	if want, got := 20, c.Counts[1]+c.Counts[2]; want != got {
+		t.Errorf("expected branches executed in %d runs but got %d", want, got)
+	}
+}